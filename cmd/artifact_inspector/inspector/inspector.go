@@ -0,0 +1,176 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package inspector verifies that the build artifacts referenced by a test
+// plan exist in Google Storage before tests are scheduled against them.
+package inspector
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"go.chromium.org/chromiumos/infra/proto/go/testplans"
+)
+
+// Artifact is a single file of a BuildPayload.
+type Artifact struct {
+	Bucket       string `json:"Bucket"`
+	Object       string `json:"Object"`
+	ArtifactType string `json:"ArtifactType"`
+	BuildTarget  string `json:"BuildTarget"`
+	BuilderName  string `json:"BuilderName"`
+}
+
+// URL returns the gs:// url of the artifact.
+func (a Artifact) URL() string {
+	return fmt.Sprintf("gs://%v/%v", a.Bucket, a.Object)
+}
+
+// Checker reports whether an object exists. GCSChecker is the real
+// implementation, tests use a fake.
+type Checker func(ctx context.Context, bucket string, object string) (bool, error)
+
+// GCSChecker returns a Checker that fetches the object's metadata.
+func GCSChecker(client *storage.Client) Checker {
+	return func(ctx context.Context, bucket string, object string) (bool, error) {
+		_, err := client.Bucket(bucket).Object(object).Attrs(ctx)
+		if err == storage.ErrObjectNotExist {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+}
+
+// ArtifactResult is the outcome of checking a single artifact.
+type ArtifactResult struct {
+	Artifact Artifact `json:"Artifact"`
+	Exists   bool     `json:"Exists"`
+	Error    string   `json:"Error,omitempty"`
+}
+
+// Report is the outcome of inspecting a set of artifacts.
+type Report struct {
+	// The number of artifacts checked.
+	Checked int `json:"Checked"`
+
+	// Artifacts which do not exist.
+	Missing []ArtifactResult `json:"Missing"`
+
+	// Artifacts whose existence couldn't be determined.
+	Errors []ArtifactResult `json:"Errors"`
+}
+
+// OK is true if every artifact was found.
+func (r *Report) OK() bool {
+	return len(r.Missing) == 0 && len(r.Errors) == 0
+}
+
+// String returns a human readable summary of the report.
+func (r *Report) String() string {
+	s := fmt.Sprintf("Checked %v artifacts, %v missing, %v errors.\n",
+		r.Checked, len(r.Missing), len(r.Errors))
+	for _, m := range r.Missing {
+		s += fmt.Sprintf("missing: %v (%v, %v %v)\n", m.Artifact.URL(),
+			m.Artifact.ArtifactType, m.Artifact.BuilderName, m.Artifact.BuildTarget)
+	}
+	for _, e := range r.Errors {
+		s += fmt.Sprintf("error: %v: %v\n", e.Artifact.URL(), e.Error)
+	}
+	return s
+}
+
+// ArtifactsOf returns the unique artifacts of every test unit in resp, sorted
+// by url.
+func ArtifactsOf(resp *testplans.GenerateTestPlanResponse) []Artifact {
+	commons := make([]*testplans.TestUnitCommon, 0)
+	for _, u := range resp.GetHwTestUnits() {
+		commons = append(commons, u.GetCommon())
+	}
+	for _, u := range resp.GetVmTestUnits() {
+		commons = append(commons, u.GetCommon())
+	}
+	for _, u := range resp.GetDirectTastVmTestUnits() {
+		commons = append(commons, u.GetCommon())
+	}
+
+	seen := make(map[string]bool)
+	artifacts := make([]Artifact, 0)
+	for _, common := range commons {
+		payload := common.GetBuildPayload()
+		if payload == nil {
+			continue
+		}
+		bucket := strings.TrimSuffix(strings.TrimPrefix(payload.ArtifactsGsBucket, "gs://"), "/")
+		for artifactType, files := range payload.GetFilesByArtifact().GetFields() {
+			for _, file := range files.GetListValue().GetValues() {
+				a := Artifact{
+					Bucket:       bucket,
+					Object:       path.Join(payload.ArtifactsGsPath, file.GetStringValue()),
+					ArtifactType: artifactType,
+					BuildTarget:  common.GetBuildTarget().GetName(),
+					BuilderName:  common.GetBuilderName(),
+				}
+				if seen[a.URL()] {
+					continue
+				}
+				seen[a.URL()] = true
+				artifacts = append(artifacts, a)
+			}
+		}
+	}
+
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].URL() < artifacts[j].URL()
+	})
+	return artifacts
+}
+
+// Inspect checks every artifact with at most jobs checks in flight.
+func Inspect(ctx context.Context, artifacts []Artifact, jobs int, check Checker) *Report {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	results := make([]ArtifactResult, len(artifacts))
+	sem := make(chan bool, jobs)
+	var wg sync.WaitGroup
+	for i, a := range artifacts {
+		wg.Add(1)
+		sem <- true
+		go func(i int, a Artifact) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			exists, err := check(ctx, a.Bucket, a.Object)
+			results[i] = ArtifactResult{Artifact: a, Exists: exists}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i, a)
+	}
+	wg.Wait()
+
+	report := &Report{
+		Checked: len(results),
+		Missing: make([]ArtifactResult, 0),
+		Errors:  make([]ArtifactResult, 0),
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			report.Errors = append(report.Errors, r)
+		} else if !r.Exists {
+			report.Missing = append(report.Missing, r)
+		}
+	}
+	return report
+}
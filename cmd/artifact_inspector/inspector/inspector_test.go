@@ -0,0 +1,112 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package inspector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	_struct "github.com/golang/protobuf/ptypes/struct"
+	"go.chromium.org/chromiumos/infra/proto/go/chromiumos"
+	"go.chromium.org/chromiumos/infra/proto/go/testplans"
+)
+
+func filesByArtifact(files map[string][]string) *_struct.Struct {
+	s := &_struct.Struct{Fields: make(map[string]*_struct.Value)}
+	for artifactType, names := range files {
+		values := make([]*_struct.Value, 0)
+		for _, name := range names {
+			values = append(values, &_struct.Value{Kind: &_struct.Value_StringValue{StringValue: name}})
+		}
+		s.Fields[artifactType] = &_struct.Value{
+			Kind: &_struct.Value_ListValue{ListValue: &_struct.ListValue{Values: values}},
+		}
+	}
+	return s
+}
+
+func common(builder string, path string, files map[string][]string) *testplans.TestUnitCommon {
+	return &testplans.TestUnitCommon{
+		BuildTarget: &chromiumos.BuildTarget{Name: "eve"},
+		BuilderName: builder,
+		BuildPayload: &testplans.BuildPayload{
+			ArtifactsGsBucket: "gs://chromeos-image-archive",
+			ArtifactsGsPath:   path,
+			FilesByArtifact:   filesByArtifact(files),
+		},
+	}
+}
+
+func testResponse() *testplans.GenerateTestPlanResponse {
+	eve := common("eve-cq", "eve-cq/R90-1.0.0", map[string][]string{
+		"AUTOTEST_FILES": {"control_files.tar"},
+		"IMAGE_ZIP":      {"image.zip"},
+	})
+	return &testplans.GenerateTestPlanResponse{
+		HwTestUnits: []*testplans.HwTestUnit{{Common: eve}},
+		// The same payload again should not be checked twice.
+		VmTestUnits: []*testplans.VmTestUnit{{Common: eve}},
+		DirectTastVmTestUnits: []*testplans.TastVmTestUnit{
+			{Common: common("betty-cq", "betty-cq/R90-1.0.0", map[string][]string{
+				"IMAGE_ZIP": {"image.zip"},
+			})},
+		},
+	}
+}
+
+func TestArtifactsOf(t *testing.T) {
+	artifacts := ArtifactsOf(testResponse())
+	expected := []string{
+		"gs://chromeos-image-archive/betty-cq/R90-1.0.0/image.zip",
+		"gs://chromeos-image-archive/eve-cq/R90-1.0.0/control_files.tar",
+		"gs://chromeos-image-archive/eve-cq/R90-1.0.0/image.zip",
+	}
+	if len(artifacts) != len(expected) {
+		t.Fatalf("expected %v artifacts, got %v: %+v", len(expected), len(artifacts), artifacts)
+	}
+	for i, a := range artifacts {
+		if a.URL() != expected[i] {
+			t.Errorf("artifact %v is %v, expected %v", i, a.URL(), expected[i])
+		}
+	}
+	if artifacts[1].ArtifactType != "AUTOTEST_FILES" || artifacts[1].BuilderName != "eve-cq" ||
+		artifacts[1].BuildTarget != "eve" {
+		t.Errorf("unexpected artifact: %+v", artifacts[1])
+	}
+}
+
+func TestInspect(t *testing.T) {
+	var mux sync.Mutex
+	checked := make(map[string]bool)
+	check := func(ctx context.Context, bucket string, object string) (bool, error) {
+		mux.Lock()
+		checked[bucket+"/"+object] = true
+		mux.Unlock()
+		switch object {
+		case "betty-cq/R90-1.0.0/image.zip":
+			return false, nil
+		case "eve-cq/R90-1.0.0/control_files.tar":
+			return false, errors.New("permission denied")
+		default:
+			return true, nil
+		}
+	}
+
+	report := Inspect(context.Background(), ArtifactsOf(testResponse()), 2, check)
+	if len(checked) != 3 || report.Checked != 3 {
+		t.Errorf("expected 3 artifacts checked, got %v", report.Checked)
+	}
+	if report.OK() {
+		t.Error("report should not be OK")
+	}
+	if len(report.Missing) != 1 || report.Missing[0].Artifact.BuilderName != "betty-cq" {
+		t.Errorf("unexpected missing: %+v", report.Missing)
+	}
+	if len(report.Errors) != 1 || report.Errors[0].Error != "permission denied" {
+		t.Errorf("unexpected errors: %+v", report.Errors)
+	}
+}
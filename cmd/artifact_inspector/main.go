@@ -0,0 +1,101 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"go.chromium.org/chromiumos/infra/proto/go/testplans"
+
+	"cloud.google.com/go/storage"
+
+	"go.chromium.org/chromiumos/infra/go/cmd/artifact_inspector/inspector"
+)
+
+// USAGE is printed by flags on --help.
+const USAGE = `
+Artifact inspector verifies that every build artifact referenced by the
+BuildPayloads of a GenerateTestPlanResponse exists in google storage.
+
+It exits 0 if all artifacts exist, 1 if any are missing or couldn't be
+checked or the json report couldn't be written and 2 on usage errors. Run it before scheduling tests to avoid wasting
+lab time on builds whose artifacts are gone.
+`
+
+func main() {
+	// Print usage.
+	flag.Usage = func() {
+		fmt.Printf("%v\n", USAGE)
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	// Loggings Flags.
+	flag.Set("logtostderr", "true")
+	flag.Set("stderrthreshold", "WARNING")
+	flag.Set("v", "0")
+
+	testPlanPath := flag.String("testPlanPath", "", "the GenerateTestPlanResponse "+
+		"input path (in binary or json representation).")
+
+	jobs := flag.Int("jobs", 64, "max number of artifacts checked concurrently.")
+
+	jsonOutFile := flag.String("jsonOutFile", "", "set if the report should be "+
+		"written to a json file instead of plain text to stdout.")
+
+	flag.Parse()
+
+	in, err := ioutil.ReadFile(*testPlanPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Couldn't read the --testPlanPath: %v\n", err)
+		flag.Usage()
+	}
+
+	resp := &testplans.GenerateTestPlanResponse{}
+	if err := proto.Unmarshal(in, resp); err != nil {
+		// Try jsonpb.
+		if err = jsonpb.Unmarshal(bytes.NewReader(in), resp); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: GenerateTestPlanResponse couldn't be unmarshaled: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Google Cloud client couldn't be constructed: %v\n", err)
+		os.Exit(2)
+	}
+
+	artifacts := inspector.ArtifactsOf(resp)
+	glog.V(0).Infof("checking %v artifacts", len(artifacts))
+	report := inspector.Inspect(ctx, artifacts, *jobs, inspector.GCSChecker(client))
+
+	if *jsonOutFile != "" {
+		// Callers rely on the report, a run without one failed.
+		if jsonBytes, err := json.Marshal(report); err != nil {
+			glog.Errorf("json marshalling failed: %v\n", err)
+			os.Exit(1)
+		} else if err := ioutil.WriteFile(*jsonOutFile, jsonBytes, 0644); err != nil {
+			glog.Errorf("json output write failed: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		fmt.Print(report.String())
+	}
+
+	if !report.OK() {
+		os.Exit(1)
+	}
+}
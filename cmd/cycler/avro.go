@@ -0,0 +1,138 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+// A minimal writer of Avro object container files (see
+// https://avro.apache.org/docs/1.10.2/spec.html#Object+Container+Files),
+// enough for the flat records of the inventory with the deflate codec.
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// avroMagic starts every Avro object container file.
+var avroMagic = []byte{'O', 'b', 'j', 1}
+
+// avroBlockRecords is the number of records per data block.
+const avroBlockRecords = 1000
+
+// avroRecord is a record that can be written with an avroWriter.
+type avroRecord interface {
+	// appendAvro appends the binary encoding of the record to b.
+	appendAvro(b *bytes.Buffer)
+}
+
+// avroWriter writes records to an Avro object container file with a single
+// schema. Records are buffered into blocks, close must be called to write
+// the last one.
+type avroWriter struct {
+	w     io.Writer
+	sync  [16]byte
+	block bytes.Buffer
+	count int64
+}
+
+// newAvroWriter writes the file header, with the json schema of the records
+// and the sync marker separating blocks, to w.
+func newAvroWriter(w io.Writer, schema string, sync [16]byte) (*avroWriter, error) {
+	var header bytes.Buffer
+	header.Write(avroMagic)
+	// The file metadata is a map with a single block of two entries.
+	appendAvroLong(&header, 2)
+	appendAvroString(&header, "avro.schema")
+	appendAvroBytes(&header, []byte(schema))
+	appendAvroString(&header, "avro.codec")
+	appendAvroBytes(&header, []byte("deflate"))
+	appendAvroLong(&header, 0)
+	header.Write(sync[:])
+
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return nil, fmt.Errorf("couldn't write avro header: %v", err)
+	}
+	return &avroWriter{w: w, sync: sync}, nil
+}
+
+// append adds r to the current block, writing it once it is full.
+func (aw *avroWriter) append(r avroRecord) error {
+	r.appendAvro(&aw.block)
+	aw.count++
+	if aw.count >= avroBlockRecords {
+		return aw.flush()
+	}
+	return nil
+}
+
+// flush writes the current block, if it has any records.
+func (aw *avroWriter) flush() error {
+	if aw.count == 0 {
+		return nil
+	}
+
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(aw.block.Bytes()); err != nil {
+		return fmt.Errorf("couldn't deflate avro block: %v", err)
+	}
+	if err := fw.Close(); err != nil {
+		return fmt.Errorf("couldn't deflate avro block: %v", err)
+	}
+
+	var block bytes.Buffer
+	appendAvroLong(&block, aw.count)
+	appendAvroLong(&block, int64(compressed.Len()))
+	block.Write(compressed.Bytes())
+	block.Write(aw.sync[:])
+	if _, err := aw.w.Write(block.Bytes()); err != nil {
+		return fmt.Errorf("couldn't write avro block: %v", err)
+	}
+
+	aw.block.Reset()
+	aw.count = 0
+	return nil
+}
+
+// close writes the last block.
+func (aw *avroWriter) close() error {
+	return aw.flush()
+}
+
+// appendAvroLong appends the zig-zag varint encoding of an Avro long (or int).
+func appendAvroLong(b *bytes.Buffer, v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+	b.Write(buf[:n])
+}
+
+// appendAvroBytes appends the length prefixed encoding of Avro bytes.
+func appendAvroBytes(b *bytes.Buffer, v []byte) {
+	appendAvroLong(b, int64(len(v)))
+	b.Write(v)
+}
+
+// appendAvroString appends the encoding of an Avro string.
+func appendAvroString(b *bytes.Buffer, v string) {
+	appendAvroLong(b, int64(len(v)))
+	b.WriteString(v)
+}
+
+// appendAvroStringMap appends the encoding of an Avro map of strings, in
+// the order of keys.
+func appendAvroStringMap(b *bytes.Buffer, m map[string]string, keys []string) {
+	if len(keys) > 0 {
+		appendAvroLong(b, int64(len(keys)))
+		for _, k := range keys {
+			appendAvroString(b, k)
+			appendAvroString(b, m[k])
+		}
+	}
+	appendAvroLong(b, 0)
+}
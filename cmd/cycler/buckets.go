@@ -0,0 +1,106 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// splitBucketSpec splits a comma separated list of bucket names or globs
+// (e.g. "gs://one,two,chromeos-*-archive") into its trimmed patterns, with
+// any gs:// decoration removed.
+func splitBucketSpec(spec string) []string {
+	patterns := make([]string, 0)
+	for _, p := range strings.Split(spec, ",") {
+		p = strings.TrimSpace(p)
+		p = strings.TrimPrefix(p, "gs://")
+		p = strings.TrimSuffix(p, "/")
+		if p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// isBucketGlob returns true if the pattern has to be matched with path.Match.
+func isBucketGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// expandBuckets returns the sorted unique buckets named by patterns. Globs are
+// matched against available, any glob matching nothing is an error.
+func expandBuckets(patterns []string, available []string) ([]string, error) {
+	found := make(map[string]bool)
+	for _, pattern := range patterns {
+		if !isBucketGlob(pattern) {
+			found[pattern] = true
+			continue
+		}
+		matched := false
+		for _, bucket := range available {
+			ok, err := path.Match(pattern, bucket)
+			if err != nil {
+				return nil, fmt.Errorf("bad bucket glob %v: %v", pattern, err)
+			}
+			if ok {
+				found[bucket] = true
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("bucket glob %v matched no buckets", pattern)
+		}
+	}
+
+	buckets := make([]string, 0, len(found))
+	for bucket := range found {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+	return buckets, nil
+}
+
+// resolveBuckets resolves a bucket spec into the buckets to iterate. Globs are
+// resolved by listing the buckets of project, which must then be set.
+func resolveBuckets(ctx context.Context, client *storage.Client, spec string,
+	project string) ([]string, error) {
+
+	patterns := splitBucketSpec(spec)
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("no bucket specified")
+	}
+
+	hasGlob := false
+	for _, pattern := range patterns {
+		hasGlob = hasGlob || isBucketGlob(pattern)
+	}
+
+	available := make([]string, 0)
+	if hasGlob {
+		if project == "" {
+			return nil, fmt.Errorf("bucket globs require --bucketProject: %v", spec)
+		}
+		it := client.Buckets(ctx, project)
+		for {
+			attrs, err := it.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("couldn't list buckets of %v: %v", project, err)
+			}
+			available = append(available, attrs.Name)
+		}
+	}
+
+	return expandBuckets(patterns, available)
+}
@@ -0,0 +1,36 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitBucketSpec(t *testing.T) {
+	actual := splitBucketSpec("gs://one, two/,,gs://three-*")
+	expected := []string{"one", "two", "three-*"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("splitBucketSpec returned %v, expected %v", actual, expected)
+	}
+}
+
+func TestExpandBuckets(t *testing.T) {
+	available := []string{"chromeos-a-archive", "chromeos-b-archive", "chromeos-c-logs"}
+	actual, err := expandBuckets([]string{"zzz", "chromeos-*-archive", "chromeos-a-archive"}, available)
+	if err != nil {
+		t.Fatalf("expandBuckets returned an err: %v", err)
+	}
+	expected := []string{"chromeos-a-archive", "chromeos-b-archive", "zzz"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expandBuckets returned %v, expected %v", actual, expected)
+	}
+}
+
+func TestExpandBucketsNoMatch(t *testing.T) {
+	if _, err := expandBuckets([]string{"nothing-*"}, []string{"something"}); err == nil {
+		t.Error("expected an error for a glob matching no buckets")
+	}
+}
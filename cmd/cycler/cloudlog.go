@@ -0,0 +1,179 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	logging "google.golang.org/api/logging/v2"
+	"google.golang.org/api/option"
+)
+
+// Cloud Logging severities used by cycler.
+const (
+	severityInfo    = "INFO"
+	severityWarning = "WARNING"
+	severityError   = "ERROR"
+)
+
+// cloudLogBatchSize is the max number of entries sent in a single write.
+const cloudLogBatchSize = 500
+
+// cloudLogFlushInterval bounds how long an entry waits in a partial batch.
+const cloudLogFlushInterval = 5 * time.Second
+
+// CloudLog is a sink streaming per-object records to Cloud Logging as
+// structured entries, so that alerting can be built on abandoned objects and
+// failed mutations without post-processing the runlog files.
+//
+// Entries are batched and written from a single routine. As with the Runlog,
+// producers block if the channel is full rather than allowing unbounded
+// unshipped logs. All methods are safe to call on a nil *CloudLog, which
+// simply drops the records.
+type CloudLog struct {
+	// Stop channel signals the logging routine to flush and stop.
+	Stop chan bool
+
+	// entries is where producers push their records.
+	entries chan *logging.LogEntry
+
+	// logName is the full resource name (projects/p/logs/id) of the log.
+	logName string
+
+	// persistRetries is the number of attempts made to write a batch.
+	persistRetries int64
+
+	// service is the Cloud Logging API client.
+	service *logging.Service
+
+	// wg is the waitgroup for routines of the logger.
+	wg *sync.WaitGroup
+}
+
+// Init sets up the cloud log writing to logID in project, opts are passed
+// through to the Cloud Logging client.
+func (cl *CloudLog) Init(ctx context.Context, project string, logID string,
+	channelSize int64, persistRetries int64, wg *sync.WaitGroup, opts ...option.ClientOption) error {
+
+	opts = append([]option.ClientOption{option.WithScopes(logging.LoggingWriteScope)}, opts...)
+	service, err := logging.NewService(ctx, opts...)
+	if err != nil {
+		return fmt.Errorf("couldn't create cloud logging client: %v", err)
+	}
+
+	cl.Stop = make(chan bool, 1)
+	cl.entries = make(chan *logging.LogEntry, channelSize)
+	cl.logName = fmt.Sprintf("projects/%v/logs/%v", project, url.PathEscape(logID))
+	cl.persistRetries = persistRetries
+	cl.service = service
+	cl.wg = wg
+
+	cl.wg.Add(1)
+	go cl.loggingCoordinator()
+	return nil
+}
+
+// Log queues a record with the json payload at the given severity.
+func (cl *CloudLog) Log(severity string, payload []byte) {
+	if cl == nil {
+		return
+	}
+	cl.entries <- &logging.LogEntry{
+		JsonPayload: payload,
+		Severity:    severity,
+		Timestamp:   time.Now().UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// LogEvent queues a record of an object or prefix cycler did not complete.
+func (cl *CloudLog) LogEvent(severity string, event string, name string, err error) {
+	if cl == nil {
+		return
+	}
+	record := map[string]interface{}{
+		"Event": event,
+		"Name":  name,
+	}
+	if err != nil {
+		record["Error"] = err.Error()
+		record["ErrorClass"] = classifyError(err)
+	}
+	payload, jerr := json.Marshal(record)
+	if jerr != nil {
+		glog.Errorf("couldn't marshal cloud log record: %v", jerr)
+		return
+	}
+	cl.Log(severity, payload)
+}
+
+func (cl *CloudLog) loggingCoordinator() {
+	defer cl.wg.Done()
+
+	batch := make([]*logging.LogEntry, 0, cloudLogBatchSize)
+	ticker := time.NewTicker(cloudLogFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case entry := <-cl.entries:
+			batch = append(batch, entry)
+			if len(batch) >= cloudLogBatchSize {
+				cl.write(batch)
+				batch = make([]*logging.LogEntry, 0, cloudLogBatchSize)
+			}
+
+		case <-ticker.C:
+			if len(batch) > 0 {
+				cl.write(batch)
+				batch = make([]*logging.LogEntry, 0, cloudLogBatchSize)
+			}
+
+		case <-cl.Stop:
+			for len(cl.entries) > 0 {
+				batch = append(batch, <-cl.entries)
+				if len(batch) >= cloudLogBatchSize {
+					cl.write(batch)
+					batch = make([]*logging.LogEntry, 0, cloudLogBatchSize)
+				}
+			}
+			if len(batch) > 0 {
+				cl.write(batch)
+			}
+			return
+		}
+	}
+}
+
+// write sends a batch of entries, retrying with backoff.
+func (cl *CloudLog) write(batch []*logging.LogEntry) {
+	req := &logging.WriteLogEntriesRequest{
+		LogName:  cl.logName,
+		Resource: &logging.MonitoredResource{Type: "global"},
+		Labels: map[string]string{
+			"cycler_invocation_id": cyclerInvocationID.String(),
+		},
+		Entries: batch,
+	}
+
+	var sleepTime time.Duration = 2 * time.Second
+	var n int64
+	for n = 0; n < cl.persistRetries; n++ {
+		_, err := cl.service.Entries.Write(req).Do()
+		if err == nil {
+			glog.V(2).Infof("wrote %v entries to %v", len(batch), cl.logName)
+			return
+		}
+		glog.V(0).Infof("retrying failed cloud log write %v: %v\nsleeping for %v...", n, err, sleepTime)
+		time.Sleep(sleepTime)
+		sleepTime <<= 1
+	}
+	glog.Errorf("dropped %v cloud log entries after %v attempts", len(batch), cl.persistRetries)
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	logging "google.golang.org/api/logging/v2"
+	"google.golang.org/api/option"
+)
+
+func TestCloudLogNil(t *testing.T) {
+	// A nil CloudLog drops records without panicking.
+	var cl *CloudLog
+	cl.Log(severityInfo, []byte("{}"))
+	cl.LogEvent(severityError, "ObjectAbandoned", "a/b", errors.New("boom"))
+}
+
+func TestCloudLogWrite(t *testing.T) {
+	var mux sync.Mutex
+	var entries []*logging.LogEntry
+	var logName string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &logging.WriteLogEntriesRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			t.Errorf("couldn't decode write request: %v", err)
+		}
+		mux.Lock()
+		entries = append(entries, req.Entries...)
+		logName = req.LogName
+		mux.Unlock()
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	cl := &CloudLog{}
+	err := cl.Init(ctx, "test-project", "cycler", 10, 1, &wg,
+		option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("Init returned an err: %v", err)
+	}
+
+	cl.Log(severityInfo, []byte(`{"Name":"a/b"}`))
+	cl.LogEvent(severityError, "ObjectAbandoned", "a/c", errors.New("boom"))
+	cl.Stop <- true
+	wg.Wait()
+
+	if logName != "projects/test-project/logs/cycler" {
+		t.Errorf("unexpected log name: %v", logName)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v", len(entries))
+	}
+	if entries[0].Severity != severityInfo || entries[1].Severity != severityError {
+		t.Errorf("unexpected severities: %v, %v", entries[0].Severity, entries[1].Severity)
+	}
+	var record map[string]string
+	if err := json.Unmarshal(entries[1].JsonPayload, &record); err != nil {
+		t.Errorf("couldn't unmarshal payload: %v", err)
+	}
+	if record["Event"] != "ObjectAbandoned" || record["Name"] != "a/c" || record["Error"] != "boom" {
+		t.Errorf("unexpected payload: %v", record)
+	}
+}
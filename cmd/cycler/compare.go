@@ -0,0 +1,371 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/storage"
+)
+
+// COMPARE_USAGE is printed by the compare subcommand's flags on --help.
+const COMPARE_USAGE = `
+cycler compare [flags] <run A> <run B>
+
+Compares two cycler runs, e.g. a noop run before and after a policy change, to
+verify the change has the intended effect before enabling mutation.
+
+A run is either its runlog (a gs:// or local directory, searched recursively
+for .jsonl.gz files, or a single .jsonl.gz file) or its --jsonOutFile results.
+Runlogs are compared object by object, results by prefix sizes only.
+`
+
+// ComparedObject is an object acted on in a compared run.
+type ComparedObject struct {
+	Bucket string `json:"Bucket"`
+	Name   string `json:"Name"`
+	Size   int64  `json:"Size"`
+	Effect string `json:"Effect"`
+}
+
+func (co *ComparedObject) key() string {
+	return co.Bucket + "/" + co.Name
+}
+
+// EffectChange is an object acted on in both runs by different effects.
+type EffectChange struct {
+	Bucket  string `json:"Bucket"`
+	Name    string `json:"Name"`
+	EffectA string `json:"EffectA"`
+	EffectB string `json:"EffectB"`
+}
+
+// PrefixDelta is the difference of the acted objects under a prefix.
+type PrefixDelta struct {
+	Prefix string `json:"Prefix"`
+	CountA int64  `json:"CountA"`
+	CountB int64  `json:"CountB"`
+	BytesA int64  `json:"BytesA"`
+	BytesB int64  `json:"BytesB"`
+}
+
+// RunComparison is the report of the compare subcommand.
+type RunComparison struct {
+	// Objects acted on only in run A or only in run B, absent for results.
+	OnlyInA []*ComparedObject `json:"OnlyInA,omitempty"`
+	OnlyInB []*ComparedObject `json:"OnlyInB,omitempty"`
+
+	// Objects acted on in both runs, by different effects.
+	EffectChanges []*EffectChange `json:"EffectChanges,omitempty"`
+
+	// Prefixes whose acted objects differ, sorted by prefix.
+	PrefixDeltas []*PrefixDelta `json:"PrefixDeltas"`
+}
+
+// compareMain runs the compare subcommand with args and returns the exit code.
+func compareMain(args []string) int {
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Printf("%v\n", COMPARE_USAGE)
+		fs.PrintDefaults()
+	}
+	prefixDepth := fs.Int("prefixDepth", 1, "the depth of the prefixes deltas "+
+		"are reported for when comparing runlogs.")
+	jsonOutFile := fs.String("jsonOutFile", "", "set if the comparison should be "+
+		"written to a json file instead of plain text to stdout.")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	comparison, err := compareRuns(context.Background(), fs.Arg(0), fs.Arg(1), *prefixDepth)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	if *jsonOutFile != "" {
+		jsonBytes, err := json.Marshal(comparison)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: json marshalling failed: %v\n", err)
+			return 1
+		}
+		if err := ioutil.WriteFile(*jsonOutFile, jsonBytes, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: json output write failed: %v\n", err)
+			return 1
+		}
+	} else {
+		fmt.Print(comparison.textResult())
+	}
+	return 0
+}
+
+// compareRuns compares the runs at a and b, which must be of the same kind.
+func compareRuns(ctx context.Context, a string, b string, prefixDepth int) (*RunComparison, error) {
+	if isResultsFile(a) != isResultsFile(b) {
+		return nil, fmt.Errorf("can't compare a runlog with results: %v, %v", a, b)
+	}
+
+	if isResultsFile(a) {
+		ra, err := readResults(a)
+		if err != nil {
+			return nil, err
+		}
+		rb, err := readResults(b)
+		if err != nil {
+			return nil, err
+		}
+		return compareResults(ra, rb), nil
+	}
+
+	var client *storage.Client
+	if strings.HasPrefix(a, "gs://") || strings.HasPrefix(b, "gs://") {
+		var err error
+		if client, err = storage.NewClient(ctx); err != nil {
+			return nil, fmt.Errorf("Google Cloud client couldn't be constructed: %v", err)
+		}
+	}
+	oa, err := readRunlog(ctx, client, a)
+	if err != nil {
+		return nil, err
+	}
+	ob, err := readRunlog(ctx, client, b)
+	if err != nil {
+		return nil, err
+	}
+	return compareObjects(oa, ob, prefixDepth), nil
+}
+
+// isResultsFile returns true if p is a --jsonOutFile rather than a runlog.
+func isResultsFile(p string) bool {
+	return strings.HasSuffix(p, ".json")
+}
+
+// comparedPolicy is the part of a policy's results that is compared.
+type comparedPolicy struct {
+	ActionStats *Stats `json:"ActionStats"`
+	BucketStats map[string]*struct {
+		ActionStats *Stats `json:"ActionStats"`
+	} `json:"BucketStats"`
+}
+
+// comparedResults is the part of the --jsonOutFile results that is compared,
+// the default policy's results are at the top level.
+type comparedResults struct {
+	comparedPolicy
+	PrefixPolicies map[string]*comparedPolicy `json:"PrefixPolicies"`
+}
+
+func readResults(p string) (*comparedResults, error) {
+	in, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read results: %v", err)
+	}
+	results := &comparedResults{}
+	if err := json.Unmarshal(in, results); err != nil {
+		return nil, fmt.Errorf("results %v couldn't be unmarshaled: %v", p, err)
+	}
+	if results.ActionStats == nil {
+		return nil, fmt.Errorf("results %v have no ActionStats", p)
+	}
+	return results, nil
+}
+
+// compareResults compares the acted on bytes per prefix of two results.
+func compareResults(a *comparedResults, b *comparedResults) *RunComparison {
+	deltas := make(map[string]*PrefixDelta)
+	delta := func(prefix string) *PrefixDelta {
+		if _, ok := deltas[prefix]; !ok {
+			deltas[prefix] = &PrefixDelta{Prefix: prefix}
+		}
+		return deltas[prefix]
+	}
+	for prefix, size := range a.actedBytes() {
+		delta(prefix).BytesA = size
+	}
+	for prefix, size := range b.actedBytes() {
+		delta(prefix).BytesB = size
+	}
+	return &RunComparison{PrefixDeltas: sortedDeltas(deltas)}
+}
+
+// actedBytes sums the acted on bytes per prefix over every policy. Runs over
+// more than one bucket also have stats per bucket, which are used instead so
+// the prefixes of different buckets are told apart, as bucket/prefix.
+func (r *comparedResults) actedBytes() map[string]int64 {
+	acted := make(map[string]int64)
+	policies := []*comparedPolicy{&r.comparedPolicy}
+	for _, pol := range r.PrefixPolicies {
+		policies = append(policies, pol)
+	}
+	for _, pol := range policies {
+		if len(pol.BucketStats) > 0 {
+			for bucket, bs := range pol.BucketStats {
+				if bs.ActionStats == nil {
+					continue
+				}
+				acted[bucket] += bs.ActionStats.RootSizeBytes
+				for prefix, size := range bs.ActionStats.PrefixMapSizeBytes {
+					acted[bucket+"/"+prefix] += size
+				}
+			}
+		} else if pol.ActionStats != nil {
+			for prefix, size := range pol.ActionStats.PrefixMapSizeBytes {
+				acted[prefix] += size
+			}
+		}
+	}
+	return acted
+}
+
+// runlogRecord is the part of a runlog line that is compared.
+type runlogRecord struct {
+	InputObject *struct {
+		Attr *struct {
+			Bucket string `json:"Bucket"`
+			Name   string `json:"Name"`
+			Size   int64  `json:"Size"`
+		} `json:"attr"`
+	} `json:"InputObject"`
+	Effect string `json:"Effect"`
+}
+
+// readRunlog returns the objects acted on in the runlog at p keyed by
+// bucket/name. Records that aren't of acted on objects are skipped.
+func readRunlog(ctx context.Context, client *storage.Client, p string) (map[string]*ComparedObject, error) {
+	objects := make(map[string]*ComparedObject)
+	err := scanRunlog(ctx, client, p, func(name string, line []byte) error {
+		var record runlogRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("runlog %v has a bad record: %v", name, err)
+		}
+		if record.InputObject == nil || record.InputObject.Attr == nil {
+			return nil
+		}
+		attr := record.InputObject.Attr
+		co := &ComparedObject{Bucket: attr.Bucket, Name: attr.Name, Size: attr.Size, Effect: record.Effect}
+		objects[co.key()] = co
+		return nil
+	})
+	return objects, err
+}
+
+// compareObjects compares the acted on objects of two runlogs.
+func compareObjects(a map[string]*ComparedObject, b map[string]*ComparedObject,
+	prefixDepth int) *RunComparison {
+
+	comparison := &RunComparison{
+		OnlyInA:       make([]*ComparedObject, 0),
+		OnlyInB:       make([]*ComparedObject, 0),
+		EffectChanges: make([]*EffectChange, 0),
+	}
+	deltas := make(map[string]*PrefixDelta)
+	delta := func(co *ComparedObject) *PrefixDelta {
+		prefix := objectPrefix(co.Bucket, co.Name, prefixDepth)
+		if _, ok := deltas[prefix]; !ok {
+			deltas[prefix] = &PrefixDelta{Prefix: prefix}
+		}
+		return deltas[prefix]
+	}
+
+	for key, ca := range a {
+		d := delta(ca)
+		d.CountA++
+		d.BytesA += ca.Size
+		if cb, ok := b[key]; !ok {
+			comparison.OnlyInA = append(comparison.OnlyInA, ca)
+		} else if ca.Effect != cb.Effect {
+			comparison.EffectChanges = append(comparison.EffectChanges, &EffectChange{
+				Bucket: ca.Bucket, Name: ca.Name, EffectA: ca.Effect, EffectB: cb.Effect,
+			})
+		}
+	}
+	for key, cb := range b {
+		d := delta(cb)
+		d.CountB++
+		d.BytesB += cb.Size
+		if _, ok := a[key]; !ok {
+			comparison.OnlyInB = append(comparison.OnlyInB, cb)
+		}
+	}
+
+	sortObjects(comparison.OnlyInA)
+	sortObjects(comparison.OnlyInB)
+	sort.Slice(comparison.EffectChanges, func(i, j int) bool {
+		ei, ej := comparison.EffectChanges[i], comparison.EffectChanges[j]
+		return ei.Bucket+"/"+ei.Name < ej.Bucket+"/"+ej.Name
+	})
+	comparison.PrefixDeltas = sortedDeltas(deltas)
+	return comparison
+}
+
+// objectPrefix returns bucket joined with up to depth directories of name.
+func objectPrefix(bucket string, name string, depth int) string {
+	dirs := strings.Split(name, "/")
+	dirs = dirs[:len(dirs)-1]
+	if len(dirs) > depth {
+		dirs = dirs[:depth]
+	}
+	return path.Join(append([]string{bucket}, dirs...)...)
+}
+
+func sortObjects(objects []*ComparedObject) {
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].key() < objects[j].key()
+	})
+}
+
+// sortedDeltas returns the deltas that differ, sorted by prefix.
+func sortedDeltas(deltas map[string]*PrefixDelta) []*PrefixDelta {
+	sorted := make([]*PrefixDelta, 0, len(deltas))
+	for _, d := range deltas {
+		if d.CountA != d.CountB || d.BytesA != d.BytesB {
+			sorted = append(sorted, d)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Prefix < sorted[j].Prefix
+	})
+	return sorted
+}
+
+// textResult returns a text representation of the comparison. Object counts
+// are only known when comparing runlogs.
+func (rc *RunComparison) textResult() string {
+	s := ""
+	runlogs := rc.OnlyInA != nil
+	if runlogs {
+		s += fmt.Sprintf("Acted on only in A: %v objects\n", len(rc.OnlyInA))
+		for _, co := range rc.OnlyInA {
+			s += fmt.Sprintf("  gs://%v (%v)\n", co.key(), co.Effect)
+		}
+		s += fmt.Sprintf("Acted on only in B: %v objects\n", len(rc.OnlyInB))
+		for _, co := range rc.OnlyInB {
+			s += fmt.Sprintf("  gs://%v (%v)\n", co.key(), co.Effect)
+		}
+		s += fmt.Sprintf("Effect changed: %v objects\n", len(rc.EffectChanges))
+		for _, ec := range rc.EffectChanges {
+			s += fmt.Sprintf("  gs://%v/%v: %v -> %v\n", ec.Bucket, ec.Name, ec.EffectA, ec.EffectB)
+		}
+	}
+	s += fmt.Sprintf("Prefix deltas: %v prefixes\n", len(rc.PrefixDeltas))
+	for _, d := range rc.PrefixDeltas {
+		if runlogs {
+			s += fmt.Sprintf("  %v: %v -> %v objects, %v -> %v\n", d.Prefix, d.CountA, d.CountB,
+				ByteCountSI(d.BytesA), ByteCountSI(d.BytesB))
+		} else {
+			s += fmt.Sprintf("  %v: %v -> %v\n", d.Prefix, ByteCountSI(d.BytesA), ByteCountSI(d.BytesB))
+		}
+	}
+	return s
+}
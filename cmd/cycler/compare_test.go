@@ -0,0 +1,161 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cloud.google.com/go/storage"
+)
+
+// writeRunlog writes records as a gzipped runlog file of the invocation
+// under dir.
+func writeRunlog(t *testing.T, dir string, invocation string, records ...interface{}) {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			t.Fatalf("couldn't marshal record: %v", err)
+		}
+		zw.Write(append(line, '\n'))
+	}
+	zw.Close()
+
+	if err := os.MkdirAll(filepath.Join(dir, invocation), 0755); err != nil {
+		t.Fatalf("couldn't create runlog dir: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, invocation, "log.jsonl.gz"), b.Bytes(), 0644); err != nil {
+		t.Fatalf("couldn't write runlog: %v", err)
+	}
+}
+
+func acted(bucket string, name string, size int64, effect string) PolicyResult {
+	return PolicyResult{
+		InputObject: map[string]interface{}{
+			"ageDays": 1,
+			"attr":    &storage.ObjectAttrs{Bucket: bucket, Name: name, Size: size},
+		},
+		Effect: effect,
+	}
+}
+
+func TestCompareRunlogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compare_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := filepath.Join(dir, "a")
+	b := filepath.Join(dir, "b")
+	writeRunlog(t, a, "a",
+		acted("bkt", "logs/1.txt", 10, "noop"),
+		acted("bkt", "logs/2.txt", 20, "noop"),
+		acted("bkt", "images/1.bin", 100, "noop"))
+	writeRunlog(t, b, "b",
+		acted("bkt", "logs/1.txt", 10, "noop"),
+		acted("bkt", "images/1.bin", 100, "delete"),
+		acted("bkt", "images/x/2.bin", 200, "delete"),
+		map[string]interface{}{"Event": "ErrorSummary"})
+
+	// A runlog may be given as a file:// url, the form it's configured in.
+	rc, err := compareRuns(context.Background(), "file://"+a, b, 1)
+	if err != nil {
+		t.Fatalf("compareRuns returned an err: %v", err)
+	}
+
+	if len(rc.OnlyInA) != 1 || rc.OnlyInA[0].Name != "logs/2.txt" {
+		t.Errorf("only in A not as expected: %+v", rc.OnlyInA)
+	}
+	if len(rc.OnlyInB) != 1 || rc.OnlyInB[0].Name != "images/x/2.bin" {
+		t.Errorf("only in B not as expected: %+v", rc.OnlyInB)
+	}
+	if len(rc.EffectChanges) != 1 || rc.EffectChanges[0].EffectA != "noop" ||
+		rc.EffectChanges[0].EffectB != "delete" {
+		t.Errorf("effect changes not as expected: %+v", rc.EffectChanges)
+	}
+
+	expected := []PrefixDelta{
+		{Prefix: "bkt/images", CountA: 1, CountB: 2, BytesA: 100, BytesB: 300},
+		{Prefix: "bkt/logs", CountA: 2, CountB: 1, BytesA: 30, BytesB: 10},
+	}
+	if len(rc.PrefixDeltas) != len(expected) {
+		t.Fatalf("expected %v prefix deltas, got %+v", len(expected), rc.PrefixDeltas)
+	}
+	for i := range expected {
+		if *rc.PrefixDeltas[i] != expected[i] {
+			t.Errorf("prefix delta %v is %+v, expected %+v", i, *rc.PrefixDeltas[i], expected[i])
+		}
+	}
+}
+
+func TestCompareResults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compare_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := filepath.Join(dir, "a.json")
+	b := filepath.Join(dir, "b.json")
+	ioutil.WriteFile(a, []byte(`{"ActionStats": {"PrefixMapSizeBytes": {"bkt": 30, "bkt/logs": 30}},
+		"PrefixPolicies": {"bkt/logs": {"ActionStats": {"PrefixMapSizeBytes": {"bkt/logs": 5}}}}}`), 0644)
+	ioutil.WriteFile(b, []byte(`{"ActionStats": {"PrefixMapSizeBytes": {"bkt": 30, "bkt/logs": 10, "bkt/images": 20}}}`), 0644)
+
+	rc, err := compareRuns(context.Background(), a, b, 1)
+	if err != nil {
+		t.Fatalf("compareRuns returned an err: %v", err)
+	}
+	if rc.OnlyInA != nil || len(rc.PrefixDeltas) != 2 {
+		t.Fatalf("comparison not as expected: %+v", rc)
+	}
+	// The prefix policy's acted bytes are added to the default policy's.
+	if d := rc.PrefixDeltas[1]; d.Prefix != "bkt/logs" || d.BytesA != 35 || d.BytesB != 10 {
+		t.Errorf("bkt/logs delta not as expected: %+v", d)
+	}
+
+	// Runs over several buckets are compared by their stats per bucket.
+	c := filepath.Join(dir, "c.json")
+	ioutil.WriteFile(c, []byte(`{"ActionStats": {"RootSizeBytes": 60, "PrefixMapSizeBytes": {"logs": 60}},
+		"BucketStats": {
+			"x": {"ActionStats": {"RootSizeBytes": 40, "PrefixMapSizeBytes": {"logs": 40}}},
+			"y": {"ActionStats": {"RootSizeBytes": 20, "PrefixMapSizeBytes": {"logs": 20}}}}}`), 0644)
+	rc, err = compareRuns(context.Background(), c, b, 1)
+	if err != nil {
+		t.Fatalf("compareRuns returned an err: %v", err)
+	}
+	bytesA := make(map[string]int64)
+	for _, d := range rc.PrefixDeltas {
+		bytesA[d.Prefix] = d.BytesA
+	}
+	if len(bytesA) != 7 || bytesA["x"] != 40 || bytesA["x/logs"] != 40 || bytesA["y/logs"] != 20 || bytesA["logs"] != 0 {
+		t.Errorf("bucket deltas not as expected: %+v", bytesA)
+	}
+
+	if _, err := compareRuns(context.Background(), a, dir, 1); err == nil {
+		t.Error("expected an err comparing results with a runlog")
+	}
+}
+
+func TestObjectPrefix(t *testing.T) {
+	cases := map[string]string{
+		"a.txt":       "bkt",
+		"x/a.txt":     "bkt/x",
+		"x/y/z/a.txt": "bkt/x/y",
+	}
+	for name, expected := range cases {
+		if actual := objectPrefix("bkt", name, 2); actual != expected {
+			t.Errorf("objectPrefix(%v) = %v, expected %v", name, actual, expected)
+		}
+	}
+}
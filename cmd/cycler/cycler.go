@@ -17,6 +17,7 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -25,7 +26,6 @@ import (
 	"regexp"
 	"runtime"
 	"runtime/debug"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -51,8 +51,20 @@ topology. The most common example is unix like path names where the delimiter is
 It provides an interface for generic effects to be mapped on to each
 discovered object. For instance, to find the 'du' like tree of object
 size, or to set acls, or even copy the object into another bucket.
+
+Run 'cycler compare --help' to compare the results of two runs.
+Run 'cycler history --help' to list the mutations of an object.
 `
 
+// Exit codes, 2 is used for usage and configuration errors.
+const (
+	// A guardrail tripped and the run was aborted.
+	exitGuardrailTripped = 1
+
+	// The run was drained on a signal and is incomplete.
+	exitDrained = 3
+)
+
 // The following are runtime stats variables.
 var (
 	objectsFound     int64
@@ -60,12 +72,14 @@ var (
 	objectsAbandoned int64
 	dirsFound        int64
 	dirsAbandoned    int64
+	errorStats       = NewErrorStats()
 )
 
 // The following are runtime control flow state variables.
 var (
 	iteratorsActive    int64 = 0
 	cmdMutationAllowed bool
+	auditStamp         bool
 	cyclerInvocationID = uuid.New()
 	retryCount         int
 )
@@ -74,15 +88,29 @@ var (
 type AttrUnit struct {
 	Attrs    *storage.ObjectAttrs `json:"Attrs"`
 	TryCount int                  `json:"TryCount"`
+
+	// Set once the object is in the prefix stats, so retries aren't counted.
+	statsSubmitted bool
 }
 
-// PrefixUnit struct tracks retries and encapsulates a prefix.
+// PrefixUnit struct tracks retries and encapsulates a prefix of a bucket.
 type PrefixUnit struct {
+	Bucket   string `json:"Bucket"`
 	Prefix   string `json:"Prefix"`
 	TryCount int    `json:"TryCount"`
 }
 
 func main() {
+	// The compare and history subcommands have their own flags.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "compare":
+			os.Exit(compareMain(os.Args[2:]))
+		case "history":
+			os.Exit(historyMain(os.Args[2:]))
+		}
+	}
+
 	// Print usage.
 	flag.Usage = func() {
 		fmt.Printf("%v\n", USAGE)
@@ -103,11 +131,21 @@ func main() {
 	// The number of concurrent worker routines.
 	workerJobs := flag.Int("workerJobs", 2000, "number of object consumer jobs")
 
+	// Optional per effect type bounds on concurrent enactments.
+	effectJobs := flag.String("effectJobs", "", "comma separated effect=jobs "+
+		"limits on concurrent enactments per effect type, bounded by workerJobs "+
+		"and lowered automatically on rate limit errors (e.g. move=50,chill=500).")
+
 	// The number of concurrent bucket iteration worker routines.
 	iterJobs := flag.Int("iterJobs", 2000, "max number of object iterator jobs")
 
-	// Optional flag to override the bucket to operate on.
-	bucket := flag.String("bucket", "", "override the bucket name to operate on (e.g. gs://newbucket).")
+	// Optional flag to override the bucket(s) to operate on.
+	bucket := flag.String("bucket", "", "override the bucket name to operate on (e.g. gs://newbucket), "+
+		"a comma separated list of names or globs iterates every bucket (e.g. gs://one,gs://two-*).")
+
+	// Needed to resolve bucket globs.
+	bucketProject := flag.String("bucketProject", "", "the GCP project whose buckets "+
+		"are listed to resolve bucket globs.")
 
 	// Optional flag to override the runlog URL.
 	runlogURL := flag.String("runlogURL", "", "override the runlog path (e.g. gs://newbucket/logs).")
@@ -115,6 +153,21 @@ func main() {
 	runConfigPath := flag.String("runConfigPath", "", "the RunConfig input path "+
 		"(in binary or json representation).")
 
+	// Optional Cloud Logging sink for per-object records.
+	cloudLoggingProject := flag.String("cloudLoggingProject", "", "if set, also "+
+		"stream per-object records to Cloud Logging in this GCP project.")
+	cloudLoggingLogID := flag.String("cloudLoggingLogID", "cycler", "the Cloud "+
+		"Logging log id records are written to.")
+	cloudLoggingOnly := flag.Bool("cloudLoggingOnly", false, "log only to Cloud "+
+		"Logging, skipping the runlog destination_url (requires --cloudLoggingProject).")
+
+	prefixPolicyConfigPath := flag.String("prefixPolicyConfigPath", "", "optional "+
+		"json file of policy effect configurations applied to objects by longest "+
+		"matching prefix instead of the RunConfig's.")
+	extendedEffectConfigPath := flag.String("extendedEffectConfigPath", "", "optional "+
+		"json file configuring an effect that has no policy effect configuration "+
+		"message (e.g. metadata), used if the RunConfig's sets no effect.")
+
 	// It is important that we never exceed the prefixChannelDepth, this
 	// will cause goroutines to block. If all goroutines block waiting
 	// waiting for this channel to have space, then there are no routines
@@ -137,9 +190,37 @@ func main() {
 	mutationAllowedFlag := flag.Bool("mutationAllowed", false, "Must be set if "+
 		"the effect specified mutates objects.")
 
+	auditStampFlag := flag.Bool("auditStamp", false, "stamp every object left by "+
+		"a mutating effect with this invocation's uuid and the effect applied, "+
+		"requires --mutationAllowed.")
+
 	jsonOutFile := flag.String("jsonOutFile", "", "set if output should be "+
 		"written to a json file instead of plain text to stdout.")
 
+	// Inventory runs record every object instead of running effects.
+	inventoryURL := flag.String("inventoryURL", "", "if set, run no effects and "+
+		"write an Avro inventory of every object to sharded files under this "+
+		"gs:// or file:// url.")
+	inventoryShardSize := flag.Int64("inventoryShardSize", 1000000,
+		"the number of objects per inventory shard file.")
+
+	// On SIGINT or SIGTERM the run drains, remaining work can be resumed.
+	drainDeadline := flag.Duration("drainDeadline", 5*time.Minute, "on SIGINT "+
+		"or SIGTERM, how long to keep working already found objects before stopping.")
+	resumeFile := flag.String("resumeFile", "", "on drain, write the unprocessed "+
+		"prefixes and objects to this file.")
+	resumeFromFile := flag.String("resumeFromFile", "", "start from the "+
+		"unprocessed work in a --resumeFile of a drained run instead of the root prefix.")
+
+	// Guardrails abort the run if a misconfigured policy acts on far more
+	// than intended. Zero disables a limit.
+	maxObjectsMutated := flag.Int64("maxObjectsMutated", 0, "abort the run if "+
+		"more than this many objects would be mutated (0 is unlimited).")
+	maxBytesCopied := flag.Int64("maxBytesCopied", 0, "abort the run if "+
+		"more than this many bytes would be copied (0 is unlimited).")
+	maxDeleteCount := flag.Int64("maxDeleteCount", 0, "abort the run if "+
+		"more than this many objects would be deleted (0 is unlimited).")
+
 	// All flags are defined. Parse the options.
 	flag.Parse()
 
@@ -154,6 +235,13 @@ func main() {
 	cmdMutationAllowed = *mutationAllowedFlag
 	retryCount = *retryCountFlag
 
+	// Stamping writes the metadata of the objects mutated.
+	auditStamp = *auditStampFlag
+	if auditStamp && !cmdMutationAllowed {
+		fmt.Fprintf(os.Stderr, "Error: --auditStamp requires --mutationAllowed\n")
+		os.Exit(2)
+	}
+
 	// Read the runConfig definition proto.
 	in, err := ioutil.ReadFile(*runConfigPath)
 	if err != nil {
@@ -173,10 +261,45 @@ func main() {
 
 	if *bucket != "" {
 		fmt.Printf("Warning: Overriding bucket %v to %v\n", runConfig.Bucket, *bucket)
-		if strings.HasPrefix(*bucket, "gs://") {
-			runConfig.Bucket = (*bucket)[5:]
-		} else {
-			runConfig.Bucket = *bucket
+		runConfig.Bucket = *bucket
+	}
+
+	limiters, err := parseEffectJobs(*effectJobs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --effectJobs: %v\n", err)
+		os.Exit(2)
+	}
+
+	var extendedConfig *ExtendedEffectConfiguration
+	if *extendedEffectConfigPath != "" {
+		if extendedConfig, err = loadExtendedEffectConfig(*extendedEffectConfigPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	prefixConfigs := map[string]*cycler_pb.PolicyEffectConfiguration{}
+	prefixExtendedConfigs := map[string]*ExtendedEffectConfiguration{}
+	if *prefixPolicyConfigPath != "" {
+		if prefixConfigs, prefixExtendedConfigs, err = loadPrefixPolicyConfigs(*prefixPolicyConfigPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+
+		// Limits set with --effectJobs take precedence over the configured ones.
+		var configLimiters map[string]*EffectLimiter
+		jobs, err := loadEffectJobs(*prefixPolicyConfigPath)
+		if err == nil {
+			configLimiters, err = effectLimiters(jobs)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: effect_jobs: %v\n", err)
+			os.Exit(2)
+		}
+		for name, limiter := range configLimiters {
+			if _, ok := limiters[name]; !ok {
+				limiters[name] = limiter
+			}
 		}
 	}
 
@@ -193,20 +316,62 @@ func main() {
 		os.Exit(2)
 	}
 
-	// The worker, iterator and logging wait groups.
+	// The bucket may be a list of buckets and globs to fan out over.
+	buckets, err := resolveBuckets(ctx, client, runConfig.Bucket, *bucketProject)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	glog.V(0).Infof("iterating buckets: %v", buckets)
+
+	// The worker, iterator, logging and cloud logging wait groups.
 	var wwg sync.WaitGroup
 	var iwg sync.WaitGroup
 	var lwg sync.WaitGroup
+	var cwg sync.WaitGroup
+
+	// Setting up the optional cloud logging sink.
+	var cloudLog *CloudLog
+	if *cloudLoggingProject != "" {
+		cloudLog = &CloudLog{}
+		if err := cloudLog.Init(ctx, *cloudLoggingProject, *cloudLoggingLogID,
+			runConfig.RunLogConfiguration.ChannelSize,
+			runConfig.RunLogConfiguration.PersistRetries, &cwg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+		if *cloudLoggingOnly {
+			fmt.Printf("Warning: Not writing runlog to %v, cloud logging only\n",
+				runConfig.RunLogConfiguration.DestinationUrl)
+			runConfig.RunLogConfiguration.DestinationUrl = ""
+		}
+	} else if *cloudLoggingOnly {
+		fmt.Fprintf(os.Stderr, "Error: --cloudLoggingOnly requires --cloudLoggingProject\n")
+		os.Exit(2)
+	}
 
 	// Setting up log sink.
 	var runlog = &Runlog{}
-	runlog.Init(runConfig.RunLogConfiguration, client, &lwg)
-
-	// Initialize the policy.
-	pol := Policy{}
-	pol.init(ctx, client, runlog.LogSink, runConfig.PolicyEffectConfiguration,
-		runConfig.StatsConfiguration, cmdMutationAllowed, runConfig.MutationAllowed,
-		cyclerInvocationID.String())
+	runlog.Init(runConfig.RunLogConfiguration, client, cloudLog, &lwg)
+
+	// Set up the optional inventory, it runs no effects so the policy isn't
+	// initialized and needs no effect configuration.
+	guardrails := NewGuardrails(*maxObjectsMutated, *maxBytesCopied, *maxDeleteCount)
+	pol := PrefixPolicies{}
+	var inventory *Inventory
+	if *inventoryURL != "" {
+		inventory = &Inventory{}
+		inventory.Init(*inventoryURL, *inventoryShardSize, client, cyclerInvocationID)
+		glog.V(0).Infof("inventory mode, no effects will run")
+	} else {
+		pol.init(ctx, client, runlog.LogSink, runConfig.PolicyEffectConfiguration,
+			extendedConfig, prefixConfigs, prefixExtendedConfigs, runConfig.StatsConfiguration, cmdMutationAllowed,
+			runConfig.MutationAllowed, cyclerInvocationID.String(), guardrails, buckets, limiters)
+		if err := pol.checkQuarantineBuckets(buckets); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+	}
 
 	// Print invocationID.
 	glog.V(0).Infof("cycler invocation uuid: %v", cyclerInvocationID)
@@ -218,24 +383,53 @@ func main() {
 	reporterStopChan := make(chan bool, 1)
 	iteratorStopChan := make(chan bool, *iterJobs)
 
-	// Set the root prefix with the passed parameter.
-	root := PrefixUnit{
-		Prefix:   *prefixRoot,
-		TryCount: 0,
+	if *resumeFromFile != "" {
+		// Pick up the work a drained run left unprocessed.
+		state, err := readResumeFile(*resumeFromFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+		if int64(len(state.Prefixes)) > *prefixChannelDepth ||
+			int64(len(state.Objects)) > *workUnitChannelDepth {
+			fmt.Fprintf(os.Stderr, "Error: resume file doesn't fit the channel depths\n")
+			os.Exit(2)
+		}
+		glog.V(0).Infof("resuming invocation %v with %v prefixes and %v objects",
+			state.InvocationID, len(state.Prefixes), len(state.Objects))
+		for _, prefix := range state.Prefixes {
+			prefixChan <- prefix
+		}
+		for _, unit := range state.Objects {
+			atomic.AddInt64(&objectsFound, 1)
+			workChan <- unit
+		}
+	} else {
+		// Set the root prefix of every bucket with the passed parameter.
+		for _, b := range buckets {
+			root := PrefixUnit{
+				Bucket:   b,
+				Prefix:   *prefixRoot,
+				TryCount: 0,
+			}
+			prefixChan <- &root
+		}
 	}
 
-	// Start the iterator jobs by sending the root.
-	prefixChan <- &root
+	// Iterators are cancellable so a drain can interrupt long listings.
+	iterCtx, cancelIterators := context.WithCancel(ctx)
+
+	// Start the iterator jobs, they share the roots sent above.
 	for j := 0; j < *iterJobs; j++ {
 		iwg.Add(1)
-		go prefixIterator(ctx, client, &iwg, runConfig.Bucket, "/", true, workChan,
-			prefixChan, iteratorStopChan, pol.PrefixRegexp())
+		go prefixIterator(iterCtx, client, &iwg, "/", true, workChan,
+			prefixChan, iteratorStopChan, pol.PrefixRegexp(), cloudLog)
 	}
 
 	// Start the object attr worker jobs.
 	for j := 0; j < *workerJobs; j++ {
 		wwg.Add(1)
-		go worker(workChan, workerStopChan, &wwg, pol)
+		go worker(workChan, workerStopChan, &wwg, &pol, inventory, cloudLog)
 	}
 
 	// Start the progress reporter
@@ -251,11 +445,16 @@ func main() {
 	//   * There are no prefixes on the stack.
 	//   * There are no work units unprocessed.
 	mainTicker := time.NewTicker(100 * time.Millisecond)
+	draining := false
 MainLoop:
 	for {
 		select {
 		case sig := <-sigsChan:
-			glog.Errorf("Signal received: %v", sig)
+			glog.Errorf("Signal received: %v, draining for up to %v", sig, *drainDeadline)
+			draining = true
+			break MainLoop
+		case <-guardrails.Tripped:
+			glog.Errorf("Aborting run, %v", guardrails.Reason)
 			break MainLoop
 		case _ = <-mainTicker.C:
 			// Ok, there was no prefixes, how about work units.
@@ -278,6 +477,28 @@ MainLoop:
 		iteratorStopChan <- true
 	}
 
+	// When draining, the iterators finish the prefixes they hold and the
+	// workers keep going until there is no more work or the deadline passes.
+	if draining {
+		deadline := time.Now().Add(*drainDeadline)
+		iterDone := make(chan bool)
+		go func() {
+			iwg.Wait()
+			close(iterDone)
+		}()
+		select {
+		case <-iterDone:
+		case <-time.After(time.Until(deadline)):
+			// Interrupted listings put their prefixes back on prefixChan.
+			glog.Errorf("Drain deadline passed with iterators active, cancelling them.")
+			cancelIterators()
+			<-iterDone
+		}
+		if !waitForDrain(deadline, workChan) {
+			glog.Errorf("Drain deadline passed with %v objects unworked.", len(workChan))
+		}
+	}
+
 	for j := 0; j < *workerJobs; j++ {
 		workerStopChan <- true
 	}
@@ -285,15 +506,48 @@ MainLoop:
 	// Block until the gsbucket iterator process is finished.
 	iwg.Wait()
 	wwg.Wait()
+	cancelIterators()
+
+	// Write the objects not yet in a full shard.
+	if inventory != nil {
+		inventory.close(ctx)
+	}
+
+	// Whatever is left on the channels was never processed.
+	if draining {
+		unprocessed := collectUnprocessed(workChan, prefixChan)
+		glog.Errorf("Drained with %v prefixes and %v objects unprocessed.",
+			len(unprocessed.Prefixes), len(unprocessed.Objects))
+		if *resumeFile != "" {
+			if err := writeResumeFile(*resumeFile, unprocessed); err != nil {
+				glog.Errorf("%v", err)
+			} else {
+				glog.Errorf("Unprocessed work written to %v, rerun with --resumeFromFile.", *resumeFile)
+			}
+		}
+	}
 
 	// We can watch the threads spin down from the iterators finishing,
 	// (which is why this is after the iwg and wwg wait()s).
 	reporterStopChan <- true
 
+	// Record the error counters of the run.
+	if summary, err := errorSummary(); err != nil {
+		glog.Errorf("%v", err)
+	} else {
+		runlog.LogSink <- summary
+	}
+
 	// Wait for logging worker group to flush.
 	runlog.Stop <- true
 	lwg.Wait()
 
+	// The runlog forwards to cloud logging, so it is stopped after it.
+	if cloudLog != nil {
+		cloudLog.Stop <- true
+		cwg.Wait()
+	}
+
 	// Print the count of errors to stderr if any.
 	if dirsAbandoned > 0 || objectsAbandoned > 0 {
 		glog.Errorf("Prefixes abandoned: %v, Objects abandoned: %v\n",
@@ -301,8 +555,15 @@ MainLoop:
 	}
 
 	// Print the chosen representation of the results.
+	var result interface {
+		jsonResult() ([]byte, error)
+		textResult() string
+	} = &pol
+	if inventory != nil {
+		result = inventory
+	}
 	if *jsonOutFile != "" {
-		if jsonBytes, err := pol.jsonResult(); err != nil {
+		if jsonBytes, err := result.jsonResult(); err != nil {
 			glog.Errorf("json marshalling failed: %v\n", err)
 		} else {
 			err := ioutil.WriteFile(*jsonOutFile, jsonBytes, 0644)
@@ -311,12 +572,23 @@ MainLoop:
 			}
 		}
 	} else {
-		glog.Infoln(pol.textResult())
+		glog.Infoln(result.textResult())
+	}
+
+	// A tripped guardrail is a failed run even though we shut down cleanly.
+	if guardrails.Reason != "" {
+		os.Exit(exitGuardrailTripped)
+	}
+
+	// A drained run is incomplete, distinguish it so it can be resumed.
+	if draining {
+		os.Exit(exitDrained)
 	}
 }
 
 // worker goroutines process messages on the work chan and call effects.
-func worker(work chan *AttrUnit, stop chan bool, wg *sync.WaitGroup, pol Policy) {
+func worker(work chan *AttrUnit, stop chan bool, wg *sync.WaitGroup, pol *PrefixPolicies,
+	inventory *Inventory, cloudLog *CloudLog) {
 	defer func() {
 		if r := recover(); r != nil {
 			glog.Errorf("recovered from panic (but routine is dead forever): %v", r)
@@ -330,17 +602,35 @@ func worker(work chan *AttrUnit, stop chan bool, wg *sync.WaitGroup, pol Policy)
 		select {
 		case unit := <-work:
 			ctx := context.Background()
-			if err := pol.submitUnit(ctx, unit); err != nil {
-				glog.V(2).Infof("error in submitUnit: %v\nWork unit: %+v", err, unit)
+			var err error
+			if inventory != nil {
+				inventory.add(ctx, unit.Attrs)
+			} else {
+				err = pol.submitUnit(ctx, unit)
+			}
+			if errors.Is(err, errGuardrailExceeded) {
+				// Retrying can't succeed, the run is being aborted.
+				glog.V(1).Infof("unit not acted on, %v: %v", err, unit.Attrs.Name)
+				atomic.AddInt64(&objectsAbandoned, 1)
+				errorStats.objectFailed(err, true)
+				cloudLog.LogEvent(severityError, "ObjectAbandoned", unit.Attrs.Name, err)
+			} else if err != nil {
+				// A failed precondition means the object changed since it was
+				// listed, a retry with the listed attrs would fail the same way.
+				retry := unit.TryCount < retryCount && classifyError(err) != errClassPrecondition
+				class := errorStats.objectFailed(err, !retry)
+				glog.V(2).Infof("%v error in submitUnit: %v\nWork unit: %+v", class, err, unit)
 
 				// Here is where the _actual_ retry is done. Send back to channel.
 				// This has the pleasant side effect of maybe deferring the work a bit.
-				if unit.TryCount < retryCount {
+				if retry {
 					unit.TryCount++
+					cloudLog.LogEvent(severityWarning, "ObjectFailed", unit.Attrs.Name, err)
 					work <- unit
 				} else {
 					glog.V(1).Infof("unit given up upon: %v", unit.Attrs.Name)
 					atomic.AddInt64(&objectsAbandoned, 1)
+					cloudLog.LogEvent(severityError, "ObjectAbandoned", unit.Attrs.Name, err)
 				}
 
 			} else {
@@ -360,9 +650,9 @@ func worker(work chan *AttrUnit, stop chan bool, wg *sync.WaitGroup, pol Policy)
 // it will place them on 'prefixChan' as approriate. It will poll
 // stop gets a message.
 func prefixIterator(ctx context.Context, client *storage.Client,
-	wg *sync.WaitGroup, bucket string, delimiter string, versions bool,
+	wg *sync.WaitGroup, delimiter string, versions bool,
 	workChan chan *AttrUnit, prefixChan chan *PrefixUnit,
-	stop chan bool, prefixRegexp *regexp.Regexp) {
+	stop chan bool, prefixRegexp *regexp.Regexp, cloudLog *CloudLog) {
 
 	var iterDelta int64
 
@@ -389,6 +679,13 @@ func prefixIterator(ctx context.Context, client *storage.Client,
 
 WorkLoop:
 	for {
+		// Stopping takes priority over taking another prefix.
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
 		select {
 		case thisPrefixUnit := <-prefixChan:
 			glog.V(4).Infof("prefix!: %v", thisPrefixUnit)
@@ -404,7 +701,7 @@ WorkLoop:
 				Versions:  versions,
 			}
 
-			it := client.Bucket(bucket).Objects(ctx, &query)
+			it := client.Bucket(thisPrefixUnit.Bucket).Objects(ctx, &query)
 			incIter(&iterDelta)
 
 			prefixUnits := make([]*PrefixUnit, 0)
@@ -417,10 +714,20 @@ WorkLoop:
 					break
 				}
 
+				// A drain cancelled the listing, throw away the partial and put the
+				// prefix back untouched so it is written to the resume file.
+				if err != nil && ctx.Err() != nil {
+					glog.V(1).Infof("listing of %v interrupted: %v\n", thisPrefixUnit.Prefix, err)
+					prefixChan <- thisPrefixUnit
+					decIter(&iterDelta)
+					continue WorkLoop
+				}
+
 				// If you've encountered an error while iterating a prefix throw away
 				// the parital and send it back to the channel with retries incremented.
 				if err != nil {
-					glog.V(1).Infof("Error encountered iterating, current iter: %v\n", it)
+					class := errorStats.prefixFailed(err, thisPrefixUnit.TryCount >= retryCount)
+					glog.V(1).Infof("%v error encountered iterating, current iter: %v\n", class, it)
 
 					if thisPrefixUnit.TryCount < retryCount {
 						thisPrefixUnit.TryCount++
@@ -428,6 +735,7 @@ WorkLoop:
 					} else {
 						atomic.AddInt64(&dirsAbandoned, 1)
 						glog.V(0).Infof("Prefix abandoned!: %v\n", it)
+						cloudLog.LogEvent(severityError, "PrefixAbandoned", thisPrefixUnit.Prefix, err)
 					}
 
 					decIter(&iterDelta)
@@ -451,6 +759,7 @@ WorkLoop:
 					// the channel. This might be the case in buckets
 					// with extremely wide fanout.
 					prefixUnit := PrefixUnit{
+						Bucket:   thisPrefixUnit.Bucket,
 						Prefix:   attr.Prefix,
 						TryCount: 0,
 					}
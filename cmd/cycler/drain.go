@@ -0,0 +1,82 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// ResumeState is the work left unprocessed by a drained run. It is written to
+// the --resumeFile on drain and read back with --resumeFromFile so a later run
+// picks up exactly where the drained one stopped.
+type ResumeState struct {
+	// The invocation that was drained.
+	InvocationID string `json:"InvocationID"`
+
+	// Prefixes that were found but not yet iterated.
+	Prefixes []*PrefixUnit `json:"Prefixes"`
+
+	// Objects that were found but not yet worked.
+	Objects []*AttrUnit `json:"Objects"`
+}
+
+// collectUnprocessed empties the work and prefix channels into a ResumeState.
+// It must only be called once no routine is sending to or receiving from them.
+func collectUnprocessed(workChan chan *AttrUnit, prefixChan chan *PrefixUnit) *ResumeState {
+	state := &ResumeState{
+		InvocationID: cyclerInvocationID.String(),
+		Prefixes:     make([]*PrefixUnit, 0, len(prefixChan)),
+		Objects:      make([]*AttrUnit, 0, len(workChan)),
+	}
+	for len(prefixChan) > 0 {
+		state.Prefixes = append(state.Prefixes, <-prefixChan)
+	}
+	for len(workChan) > 0 {
+		state.Objects = append(state.Objects, <-workChan)
+	}
+	return state
+}
+
+// writeResumeFile writes the state as json to path.
+func writeResumeFile(path string, state *ResumeState) error {
+	out, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("resume state couldn't be marshaled: %v", err)
+	}
+	if err := ioutil.WriteFile(path, out, 0644); err != nil {
+		return fmt.Errorf("resume file couldn't be written: %v", err)
+	}
+	return nil
+}
+
+// readResumeFile reads a state written by writeResumeFile.
+func readResumeFile(path string) (*ResumeState, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("resume file couldn't be read: %v", err)
+	}
+	state := &ResumeState{}
+	if err := json.Unmarshal(in, state); err != nil {
+		return nil, fmt.Errorf("resume file couldn't be unmarshaled: %v", err)
+	}
+	return state, nil
+}
+
+// waitForDrain blocks until the work channel is empty or the deadline passes,
+// returning true if it emptied in time.
+func waitForDrain(deadline time.Time, workChan chan *AttrUnit) bool {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for len(workChan) > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		<-ticker.C
+	}
+	return true
+}
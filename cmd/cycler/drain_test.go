@@ -0,0 +1,107 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+func TestResumeFileRoundTrip(t *testing.T) {
+	workChan := make(chan *AttrUnit, 10)
+	prefixChan := make(chan *PrefixUnit, 10)
+
+	prefixChan <- &PrefixUnit{Bucket: "b", Prefix: "dir1/", TryCount: 1}
+	prefixChan <- &PrefixUnit{Bucket: "b", Prefix: "dir2/"}
+	workChan <- &AttrUnit{Attrs: &storage.ObjectAttrs{Bucket: "b", Name: "obj", Size: 42}, TryCount: 2}
+
+	state := collectUnprocessed(workChan, prefixChan)
+	if len(workChan) != 0 || len(prefixChan) != 0 {
+		t.Error("channels were not emptied")
+	}
+	if len(state.Prefixes) != 2 || len(state.Objects) != 1 {
+		t.Fatalf("unexpected state: %+v", state)
+	}
+
+	dir, err := ioutil.TempDir("", "drain_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "resume.json")
+	if err := writeResumeFile(path, state); err != nil {
+		t.Fatalf("writeResumeFile returned an err: %v", err)
+	}
+	read, err := readResumeFile(path)
+	if err != nil {
+		t.Fatalf("readResumeFile returned an err: %v", err)
+	}
+
+	if read.InvocationID != cyclerInvocationID.String() {
+		t.Errorf("unexpected invocation id: %v", read.InvocationID)
+	}
+	if *read.Prefixes[0] != *state.Prefixes[0] || *read.Prefixes[1] != *state.Prefixes[1] {
+		t.Errorf("prefixes differ: %+v vs %+v", read.Prefixes, state.Prefixes)
+	}
+	obj := read.Objects[0]
+	if obj.TryCount != 2 || obj.Attrs.Name != "obj" || obj.Attrs.Bucket != "b" || obj.Attrs.Size != 42 {
+		t.Errorf("object differs: %+v", obj.Attrs)
+	}
+}
+
+func TestWaitForDrain(t *testing.T) {
+	workChan := make(chan *AttrUnit, 1)
+	if !waitForDrain(time.Now(), workChan) {
+		t.Error("an empty channel should be drained")
+	}
+
+	workChan <- &AttrUnit{}
+	if waitForDrain(time.Now().Add(200*time.Millisecond), workChan) {
+		t.Error("a channel nobody reads should not drain")
+	}
+}
+
+func TestCancelledListingRequeued(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client, err := storage.NewClient(context.Background(), option.WithoutAuthentication(),
+		option.WithEndpoint("http://127.0.0.1:1/storage/v1/"))
+	if err != nil {
+		t.Fatalf("couldn't construct client: %v", err)
+	}
+
+	workChan := make(chan *AttrUnit, 1)
+	prefixChan := make(chan *PrefixUnit, 1)
+	stop := make(chan bool, 1)
+	prefixChan <- &PrefixUnit{Bucket: "b", Prefix: "p/", TryCount: 1}
+	abandoned := atomic.LoadInt64(&dirsAbandoned)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go prefixIterator(ctx, client, &wg, "/", false, workChan, prefixChan, stop, nil, nil)
+	time.Sleep(100 * time.Millisecond)
+	stop <- true
+	wg.Wait()
+
+	if len(prefixChan) != 1 {
+		t.Fatalf("expected the interrupted prefix back on the channel, got %v", len(prefixChan))
+	}
+	if unit := <-prefixChan; unit.Prefix != "p/" || unit.TryCount != 1 {
+		t.Errorf("requeued prefix differs: %+v", unit)
+	}
+	if atomic.LoadInt64(&dirsAbandoned) != abandoned {
+		t.Error("an interrupted prefix shouldn't be abandoned")
+	}
+}
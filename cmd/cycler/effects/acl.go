@@ -0,0 +1,312 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package effects
+
+// ACL replaces the access control list of the object with the one of the
+// first rule matching its name and age. Buckets with uniform bucket-level
+// access have no object ACLs, they can't be used with this effect.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+func (ae ACLEffect) DefaultActor() interface{} {
+	return objectUpdateAttrs
+}
+
+// ACLEffectConfiguration configures the acl effect. There is no proto message
+// for it, it is read from the extended effect configuration.
+type ACLEffectConfiguration struct {
+	// Rules in order of precedence, the first matching an object applies.
+	Rules []*ACLRuleConfiguration `json:"rules"`
+
+	// Must be set for any rule to grant access to allUsers.
+	AllowAllUsers bool `json:"allow_all_users"`
+}
+
+// ACLRuleConfiguration is the ACL to set on objects with a name prefix and a
+// minimum age.
+type ACLRuleConfiguration struct {
+	// The object name prefix the rule applies to, empty for all objects.
+	Prefix string `json:"prefix"`
+
+	// The minimum age in days of the objects the rule applies to.
+	MinAgeDays int64 `json:"min_age_days"`
+
+	// The entries of the object ACL, e.g. {"entity": "group-a@b.com", "role": "READER"}.
+	ACL []ACLEntryConfiguration `json:"acl"`
+
+	// If set instead of ACL, a predefined ACL (e.g. projectPrivate).
+	PredefinedACL string `json:"predefined_acl"`
+}
+
+// ACLEntryConfiguration is a single entry of an ACL.
+type ACLEntryConfiguration struct {
+	Entity string `json:"entity"`
+	Role   string `json:"role"`
+}
+
+// Entities and predefined ACLs that grant public access, to anyone or to
+// anyone with a Google account.
+var (
+	publicEntities       = []storage.ACLEntity{storage.AllUsers, storage.AllAuthenticatedUsers}
+	publicPredefinedACLs = []string{"publicRead", "publicReadWrite", "authenticatedRead"}
+)
+
+// aclPattern is an entry of a predefined ACL, the entity is either exact or,
+// ending in '-', a prefix (the project number of project entities varies).
+type aclPattern struct {
+	entity string
+	role   storage.ACLRole
+}
+
+// The entries the object predefined ACLs expand to, besides the owner's.
+var predefinedACLs = map[string][]aclPattern{
+	"authenticatedRead":      {{"allAuthenticatedUsers", storage.RoleReader}},
+	"bucketOwnerFullControl": {{"project-owners-", storage.RoleOwner}},
+	"bucketOwnerRead":        {{"project-owners-", storage.RoleReader}},
+	"private":                {},
+	"projectPrivate": {
+		{"project-owners-", storage.RoleOwner},
+		{"project-editors-", storage.RoleOwner},
+		{"project-viewers-", storage.RoleReader},
+	},
+	"publicRead": {{"allUsers", storage.RoleReader}},
+}
+
+// Validate is the pre-flight check of the configuration, it refuses to grant
+// public (allUsers or allAuthenticatedUsers) access unless AllowAllUsers is
+// set.
+func (c *ACLEffectConfiguration) Validate() error {
+	if len(c.Rules) == 0 {
+		return fmt.Errorf("acl effect configuration has no rules")
+	}
+	for i, rule := range c.Rules {
+		if (len(rule.ACL) == 0) == (rule.PredefinedACL == "") {
+			return fmt.Errorf("acl rule %v must set exactly one of acl and predefined_acl", i)
+		}
+		for _, entry := range rule.ACL {
+			if entry.Entity == "" {
+				return fmt.Errorf("acl rule %v has an entry without an entity", i)
+			}
+			switch storage.ACLRole(entry.Role) {
+			case storage.RoleOwner, storage.RoleReader, storage.RoleWriter:
+			default:
+				return fmt.Errorf("acl rule %v has an invalid role for %v: %q", i, entry.Entity, entry.Role)
+			}
+			for _, public := range publicEntities {
+				if storage.ACLEntity(entry.Entity) == public && !c.AllowAllUsers {
+					return fmt.Errorf("acl rule %v grants %v access without allow_all_users", i, public)
+				}
+			}
+		}
+		for _, public := range publicPredefinedACLs {
+			if rule.PredefinedACL == public && !c.AllowAllUsers {
+				return fmt.Errorf("acl rule %v predefined acl %v grants public access "+
+					"without allow_all_users", i, public)
+			}
+		}
+		if _, ok := predefinedACLs[rule.PredefinedACL]; rule.PredefinedACL != "" && !ok {
+			return fmt.Errorf("acl rule %v has an unknown object predefined acl %q", i, rule.PredefinedACL)
+		}
+	}
+	return nil
+}
+
+// ACLEffect runtime and configuration state.
+type ACLEffect struct {
+	Config *ACLEffectConfiguration `json:"ACLEffectConfiguration"`
+	auditStamp
+
+	// Real or mock actor, non-test invocations use util.objectUpdateAttrs.
+	actor func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
+		update storage.ObjectAttrsToUpdate) error
+
+	// Used instead of time.Now for the object age, for tests.
+	now func() time.Time
+}
+
+// Init the acl effect.
+func (ae *ACLEffect) Initialize(config interface{}, actor interface{}, checks ...bool) {
+	orig, ok := config.(*ACLEffectConfiguration)
+	if !ok {
+		log.Printf("Config could not be typecast: %+v", ok)
+		os.Exit(2)
+	}
+
+	// Validate the configuration.
+	if err := orig.Validate(); err != nil {
+		log.Printf("%v", err)
+		os.Exit(2)
+	}
+
+	CheckMutationAllowed(checks)
+
+	ae.Config = orig
+	ae.actor = actor.(func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
+		update storage.ObjectAttrsToUpdate) error)
+	ae.now = time.Now
+}
+
+// Enact sets the ACL of the first matching rule on the attr. Objects no rule
+// applies to (yet), or already having the rule's ACL, are left untouched and
+// not acted on.
+func (ae *ACLEffect) Enact(ctx context.Context, client *storage.Client, attr *storage.ObjectAttrs) (EffectResult, error) {
+	rule := ae.ruleFor(attr)
+	if rule == nil || rule.appliedTo(attr) {
+		return &ACLResult{skipped: true}, nil
+	}
+
+	update := storage.ObjectAttrsToUpdate{}
+	if rule.PredefinedACL != "" {
+		update.PredefinedACL = rule.PredefinedACL
+	} else {
+		update.ACL = rule.rules()
+	}
+	ae.stampUpdate(&update, "acl")
+	if err := ae.actor(ctx, client, attr, update); err != nil {
+		return nil, fmt.Errorf("Error setting acl of object (%v) in ACLEffect.Enact: %w", attr.Name, err)
+	}
+
+	textResult := fmt.Sprintf("%+v", attr)
+	jsonResult, err := json.Marshal(attr)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling json in ACLEffect.Enact: %v", err)
+	}
+
+	ar := ACLResult{
+		acted:       true,
+		jsonResult:  string(jsonResult),
+		textResult:  textResult,
+		auditTarget: auditTarget{bucket: attr.Bucket, name: attr.Name},
+	}
+	return &ar, nil
+}
+
+// ruleFor returns the first rule applying to attr, or nil.
+func (ae *ACLEffect) ruleFor(attr *storage.ObjectAttrs) *ACLRuleConfiguration {
+	ageDays := int64(ae.now().Sub(attr.Created).Hours() / 24)
+	for _, rule := range ae.Config.Rules {
+		if strings.HasPrefix(attr.Name, rule.Prefix) && ageDays >= rule.MinAgeDays {
+			return rule
+		}
+	}
+	return nil
+}
+
+// rules returns the storage ACL of the rule's entries.
+func (rule *ACLRuleConfiguration) rules() []storage.ACLRule {
+	acl := make([]storage.ACLRule, 0, len(rule.ACL))
+	for _, entry := range rule.ACL {
+		acl = append(acl, storage.ACLRule{
+			Entity: storage.ACLEntity(entry.Entity),
+			Role:   storage.ACLRole(entry.Role),
+		})
+	}
+	return acl
+}
+
+// appliedTo returns true if attr already has the rule's ACL.
+func (rule *ACLRuleConfiguration) appliedTo(attr *storage.ObjectAttrs) bool {
+	if rule.PredefinedACL != "" {
+		return matchesPredefinedACL(attr, predefinedACLs[rule.PredefinedACL])
+	}
+	return sameACL(attr.ACL, rule.rules())
+}
+
+// matchesPredefinedACL returns true if the entries of attr's ACL, other than
+// the owner's, match the patterns one to one.
+func matchesPredefinedACL(attr *storage.ObjectAttrs, patterns []aclPattern) bool {
+	matched := make([]bool, len(patterns))
+	for _, entry := range attr.ACL {
+		if string(entry.Entity) == attr.Owner && entry.Role == storage.RoleOwner {
+			continue
+		}
+		found := false
+		for i, p := range patterns {
+			if matched[i] || entry.Role != p.role {
+				continue
+			}
+			if string(entry.Entity) == p.entity ||
+				(strings.HasSuffix(p.entity, "-") && strings.HasPrefix(string(entry.Entity), p.entity)) {
+				matched[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, m := range matched {
+		if !m {
+			return false
+		}
+	}
+	return true
+}
+
+// sameACL returns true if the ACLs have the same entity and role pairs.
+func sameACL(a []storage.ACLRule, b []storage.ACLRule) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	key := func(r storage.ACLRule) string {
+		return string(r.Entity) + ":" + string(r.Role)
+	}
+	ka := make([]string, 0, len(a))
+	kb := make([]string, 0, len(b))
+	for i := range a {
+		ka = append(ka, key(a[i]))
+		kb = append(kb, key(b[i]))
+	}
+	sort.Strings(ka)
+	sort.Strings(kb)
+	for i := range ka {
+		if ka[i] != kb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ACLResult defines all outputs of an acl effect, its audit target is the
+// object itself.
+type ACLResult struct {
+	acted      bool
+	skipped    bool
+	jsonResult string
+	textResult string
+	auditTarget
+}
+
+// HasActed is true if the effect was applied.
+func (ar ACLResult) HasActed() bool {
+	return ar.acted
+}
+
+// Skipped is true if the object was left alone on purpose.
+func (ar ACLResult) Skipped() bool {
+	return ar.skipped
+}
+
+// JSONResult is the JSON result.
+func (ar ACLResult) JSONResult() string {
+	return ar.jsonResult
+}
+
+// TextResult is the unformatted text result.
+func (ar ACLResult) TextResult() string {
+	return ar.textResult
+}
@@ -0,0 +1,127 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package effects
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+func testACLConfig() *ACLEffectConfiguration {
+	return &ACLEffectConfiguration{
+		Rules: []*ACLRuleConfiguration{
+			{
+				Prefix:     "builds/",
+				MinAgeDays: 90,
+				ACL:        []ACLEntryConfiguration{{Entity: "group-infra@example.com", Role: "READER"}},
+			},
+			{
+				Prefix:        "builds/",
+				PredefinedACL: "projectPrivate",
+			},
+		},
+	}
+}
+
+func TestACLEffect(t *testing.T) {
+	now := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	var updates []storage.ObjectAttrsToUpdate
+	actor := func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
+		update storage.ObjectAttrsToUpdate) error {
+		updates = append(updates, update)
+		return nil
+	}
+
+	ae := ACLEffect{}
+	ae.Initialize(testACLConfig(), actor)
+	ae.now = func() time.Time { return now }
+
+	old := &storage.ObjectAttrs{Name: "builds/a.bin", Created: now.AddDate(0, 0, -100)}
+	recent := &storage.ObjectAttrs{Name: "builds/b.bin", Created: now.AddDate(0, 0, -10)}
+	done := &storage.ObjectAttrs{
+		Name:    "builds/c.bin",
+		Created: now.AddDate(0, 0, -100),
+		ACL:     []storage.ACLRule{{Entity: "group-infra@example.com", Role: storage.RoleReader}},
+	}
+	recentDone := &storage.ObjectAttrs{
+		Name:    "builds/d.bin",
+		Owner:   "user-builder@example.com",
+		Created: now.AddDate(0, 0, -10),
+		ACL: []storage.ACLRule{
+			{Entity: "user-builder@example.com", Role: storage.RoleOwner},
+			{Entity: "project-owners-1234", Role: storage.RoleOwner},
+			{Entity: "project-editors-1234", Role: storage.RoleOwner},
+			{Entity: "project-viewers-1234", Role: storage.RoleReader},
+		},
+	}
+	unmatched := &storage.ObjectAttrs{Name: "logs/a.txt"}
+	for _, c := range []struct {
+		attr  *storage.ObjectAttrs
+		acted bool
+	}{{old, true}, {recent, true}, {done, false}, {recentDone, false}, {unmatched, false}} {
+		res, err := ae.Enact(context.Background(), nil, c.attr)
+		if err != nil {
+			t.Fatalf("aclResult returned an err:\n%+v", err)
+		}
+		if res.(SkippedResult).Skipped() == c.acted {
+			t.Errorf("aclResult.Skipped() for %v is %v, expected %v", c.attr.Name, c.acted, !c.acted)
+		}
+		if res.HasActed() != c.acted {
+			t.Errorf("aclResult.HasActed() for %v is %v, expected %v", c.attr.Name, res.HasActed(), c.acted)
+		}
+	}
+
+	if len(updates) != 2 {
+		t.Fatalf("expected 2 updates (up to date objects are skipped), got %v", len(updates))
+	}
+	if len(updates[0].ACL) != 1 || updates[0].ACL[0].Entity != "group-infra@example.com" {
+		t.Errorf("old object acl not as expected: %+v", updates[0])
+	}
+	if updates[1].PredefinedACL != "projectPrivate" {
+		t.Errorf("recent object acl not as expected: %+v", updates[1])
+	}
+}
+
+func TestACLEffectConfigurationValidate(t *testing.T) {
+	public := &ACLEffectConfiguration{Rules: []*ACLRuleConfiguration{
+		{ACL: []ACLEntryConfiguration{{Entity: "allUsers", Role: "READER"}}},
+	}}
+	if err := public.Validate(); err == nil {
+		t.Error("expected an err granting allUsers access")
+	}
+	public.AllowAllUsers = true
+	if err := public.Validate(); err != nil {
+		t.Errorf("expected allow_all_users to permit allUsers: %v", err)
+	}
+
+	for _, name := range []string{"publicRead", "authenticatedRead"} {
+		predefined := &ACLEffectConfiguration{Rules: []*ACLRuleConfiguration{{PredefinedACL: name}}}
+		if err := predefined.Validate(); err == nil {
+			t.Errorf("expected an err for the public predefined acl %v", name)
+		}
+	}
+
+	authenticated := &ACLEffectConfiguration{Rules: []*ACLRuleConfiguration{
+		{ACL: []ACLEntryConfiguration{{Entity: "allAuthenticatedUsers", Role: "READER"}}},
+	}}
+	if err := authenticated.Validate(); err == nil {
+		t.Error("expected an err granting allAuthenticatedUsers access")
+	}
+
+	bad := map[string]*ACLEffectConfiguration{
+		"no rules": {},
+		"both":     {Rules: []*ACLRuleConfiguration{{PredefinedACL: "private", ACL: []ACLEntryConfiguration{{Entity: "a", Role: "READER"}}}}},
+		"role":     {Rules: []*ACLRuleConfiguration{{ACL: []ACLEntryConfiguration{{Entity: "a", Role: "ADMIN"}}}}},
+		"unknown":  {Rules: []*ACLRuleConfiguration{{PredefinedACL: "teamOnly"}}},
+	}
+	for name, config := range bad {
+		if err := config.Validate(); err == nil {
+			t.Errorf("expected an err for %v", name)
+		}
+	}
+}
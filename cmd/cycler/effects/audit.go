@@ -0,0 +1,93 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package effects
+
+// Audit stamps record on a mutated object the invocation and effect that
+// last mutated it, the runlogs of the invocations hold the full history.
+
+import (
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// Metadata keys of the audit stamp.
+const (
+	AuditInvocationKey = "cycler-invocation"
+	AuditEffectKey     = "cycler-effect"
+	AuditTimeKey       = "cycler-mutated"
+)
+
+// Audited is implemented by effects that leave a mutated object behind, in
+// place or at a new location. Effects that only delete or read objects don't
+// implement it.
+type Audited interface {
+	// SetAuditStamp makes the effect stamp the objects it leaves with the audit
+	// metadata of the invocation, as part of the copy or update that mutates
+	// them.
+	SetAuditStamp(invocationID string)
+}
+
+// AuditedResult is implemented by the results of audited effects.
+type AuditedResult interface {
+	// AuditTarget returns the bucket and name of the object the effect left,
+	// ok is false if it left none.
+	AuditTarget() (bucket string, name string, ok bool)
+}
+
+// auditStamp is the stamping state of an audited effect.
+type auditStamp struct {
+	invocationID string
+}
+
+// SetAuditStamp turns stamping on for the invocation.
+func (as *auditStamp) SetAuditStamp(invocationID string) {
+	as.invocationID = invocationID
+}
+
+// stamp returns the audit stamp of a mutation by effect now, or nil if
+// stamping is off.
+func (as *auditStamp) stamp(effect string) map[string]string {
+	if as.invocationID == "" {
+		return nil
+	}
+	return AuditMetadata(as.invocationID, effect, time.Now())
+}
+
+// stampUpdate adds the audit stamp of a mutation by effect now to update, if
+// stamping is on.
+func (as *auditStamp) stampUpdate(update *storage.ObjectAttrsToUpdate, effect string) {
+	stamp := as.stamp(effect)
+	if stamp == nil {
+		return
+	}
+	if update.Metadata == nil {
+		update.Metadata = make(map[string]string)
+	}
+	for k, v := range stamp {
+		update.Metadata[k] = v
+	}
+}
+
+// auditTarget is the object an audited effect left, empty if none.
+type auditTarget struct {
+	bucket string
+	name   string
+}
+
+// AuditTarget returns the object the effect left.
+func (at auditTarget) AuditTarget() (string, string, bool) {
+	return at.bucket, at.name, at.name != ""
+}
+
+// AuditMetadata returns the audit stamp of a mutation by the effect in the
+// invocation at time t.
+func AuditMetadata(invocationID string, effect string, t time.Time) map[string]string {
+	return map[string]string{
+		AuditInvocationKey: invocationID,
+		AuditEffectKey:     effect,
+		AuditTimeKey:       t.UTC().Format(time.RFC3339),
+	}
+}
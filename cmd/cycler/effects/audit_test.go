@@ -0,0 +1,142 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package effects
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	cycler_pb "go.chromium.org/chromiumos/infra/proto/go/cycler"
+)
+
+func TestAuditTarget(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	attr := &storage.ObjectAttrs{
+		Bucket:       "test_bucket",
+		Name:         "builds/8765/test_object.txt",
+		StorageClass: "STANDARD",
+		Created:      now.AddDate(0, 0, -100),
+	}
+
+	// The metadata each effect's actor was asked to set.
+	var stamped map[string]string
+	copyActor := func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
+		dstBucket string, prefix string, deleteAfter bool, metadata map[string]string) error {
+		stamped = metadata
+		return nil
+	}
+	updateActor := func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
+		update storage.ObjectAttrsToUpdate) error {
+		stamped = update.Metadata
+		return nil
+	}
+
+	me := &MoveEffect{}
+	me.Initialize(&cycler_pb.MoveEffectConfiguration{
+		DestinationBucket: "test_dest",
+		DestinationPrefix: "moved/",
+	}, copyActor)
+
+	de := &DuplicateEffect{}
+	de.Initialize(&cycler_pb.DuplicateEffectConfiguration{
+		DestinationBucket: "test_dest",
+		DestinationPrefix: "copied/",
+	}, copyActor)
+
+	ce := &ChillEffect{}
+	ce.Initialize(&cycler_pb.ChillEffectConfiguration{
+		ToStorageClass: cycler_pb.ChillEffectConfiguration_COLDLINE,
+	}, func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
+		toStorageClass cycler_pb.ChillEffectConfiguration_EnumStorageClass, metadata map[string]string) error {
+		stamped = metadata
+		return nil
+	})
+
+	mde := &MetadataEffect{}
+	mde.Initialize(testMetadataConfig(), updateActor)
+
+	ae := &ACLEffect{}
+	ae.Initialize(testACLConfig(), updateActor)
+	ae.now = func() time.Time { return now }
+
+	qe := &QuarantineEffect{}
+	qe.Initialize(&QuarantineEffectConfiguration{
+		QuarantineBucket: "test_quarantine",
+		QuarantinePrefix: "q/",
+		RetentionDays:    30,
+	}, QuarantineActors{
+		Quarantine: func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
+			dstBucket string, dstName string, metadata map[string]string) error {
+			stamped = metadata
+			return nil
+		},
+		Delete: func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs) error {
+			stamped = nil
+			return nil
+		},
+	})
+	qe.now = func() time.Time { return now }
+
+	cases := []struct {
+		effect     Effect
+		attr       *storage.ObjectAttrs
+		effectName string
+		bucket     string
+		name       string
+	}{
+		{me, attr, "move", "test_dest", "moved/builds/8765/test_object.txt"},
+		{de, attr, "duplicate", "test_dest", "copied/builds/8765/test_object.txt"},
+		{ce, attr, "chill", "test_bucket", "builds/8765/test_object.txt"},
+		{mde, attr, "metadata", "test_bucket", "builds/8765/test_object.txt"},
+		{ae, attr, "acl", "test_bucket", "builds/8765/test_object.txt"},
+		{qe, attr, "quarantine", "test_quarantine", "q/test_bucket/builds/8765/test_object.txt"},
+		// Deleting an expired quarantined object leaves none.
+		{qe, &storage.ObjectAttrs{Bucket: "test_quarantine", Name: "q/test_bucket/a.txt",
+			Metadata: map[string]string{
+				QuarantineOriginalNameKey: "a.txt",
+				QuarantineExpiresKey:      now.Format(time.RFC3339),
+			}}, "quarantine", "", ""},
+	}
+	for i, c := range cases {
+		c.effect.(Audited).SetAuditStamp("1234")
+		stamped = nil
+		res, err := c.effect.Enact(ctx, nil, c.attr)
+		if err != nil || !res.HasActed() {
+			t.Fatalf("case %v: expected the effect to act, got %+v, %v", i, res, err)
+		}
+		bucket, name, ok := res.(AuditedResult).AuditTarget()
+		if ok != (c.name != "") || bucket != c.bucket || name != c.name {
+			t.Errorf("case %v: got target (%v, %v, %v), expected (%v, %v)", i, bucket, name, ok, c.bucket, c.name)
+		}
+		if ok && (stamped[AuditInvocationKey] != "1234" || stamped[AuditEffectKey] != c.effectName) {
+			t.Errorf("case %v: the mutation wasn't stamped: %+v", i, stamped)
+		}
+	}
+
+	// Without a stamp set, nothing is added to the mutation.
+	stamped = nil
+	unstamped := &MoveEffect{}
+	unstamped.Initialize(me.Config, copyActor)
+	if _, err := unstamped.Enact(ctx, nil, attr); err != nil || stamped != nil {
+		t.Errorf("expected no stamp, got %+v, %v", stamped, err)
+	}
+
+	var effect Effect = &DeleteEffect{}
+	if _, ok := effect.(Audited); ok {
+		t.Error("the delete effect leaves no object and shouldn't be audited")
+	}
+}
+
+func TestAuditMetadata(t *testing.T) {
+	at := time.Date(2021, 3, 1, 12, 0, 0, 0, time.FixedZone("PST", -8*60*60))
+	metadata := AuditMetadata("1234", "move", at)
+	if metadata[AuditInvocationKey] != "1234" || metadata[AuditEffectKey] != "move" ||
+		metadata[AuditTimeKey] != "2021-03-01T20:00:00Z" {
+		t.Errorf("audit metadata not as expected: %+v", metadata)
+	}
+}
@@ -28,9 +28,10 @@ func (ce ChillEffect) DefaultActor() interface{} {
 // ChillEffect runtime and configuration state.
 type ChillEffect struct {
 	Config *cycler_pb.ChillEffectConfiguration `json:"ChillEffectConfiguration"`
+	auditStamp
 	// Real or mock actor, non-test invocations use util.objectChangeStorageClass
 	actor func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
-		toStorageClass cycler_pb.ChillEffectConfiguration_EnumStorageClass) error
+		toStorageClass cycler_pb.ChillEffectConfiguration_EnumStorageClass, metadata map[string]string) error
 }
 
 // Init the chill effect.
@@ -51,16 +52,20 @@ func (ce *ChillEffect) Initialize(config interface{}, actor interface{}, checks
 
 	ce.Config = orig
 	ce.actor = actor.(func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
-		toStorageClass cycler_pb.ChillEffectConfiguration_EnumStorageClass) error)
+		toStorageClass cycler_pb.ChillEffectConfiguration_EnumStorageClass, metadata map[string]string) error)
 
 }
 
 // Enact does the move operation on the attr, _this deletes the old object_!
 func (ce *ChillEffect) Enact(ctx context.Context, client *storage.Client, attr *storage.ObjectAttrs) (EffectResult, error) {
+	// Objects that already have the storage class are left and not acted on.
+	if attr.StorageClass == cycler_pb.ChillEffectConfiguration_EnumStorageClass.String(ce.Config.ToStorageClass) {
+		return &ChillResult{skipped: true}, nil
+	}
 	err := ce.chillObject(ctx, client, attr)
 
 	if err != nil {
-		return nil, fmt.Errorf("Error chilling object (%v) in chillEffect.Enact: %v", attr.Name, err)
+		return nil, fmt.Errorf("Error chilling object (%v) in chillEffect.Enact: %w", attr.Name, err)
 	}
 
 	textResult := fmt.Sprintf("%+v", attr)
@@ -71,9 +76,10 @@ func (ce *ChillEffect) Enact(ctx context.Context, client *storage.Client, attr *
 	}
 
 	cr := ChillResult{
-		acted:      true,
-		jsonResult: string(jsonResult),
-		textResult: textResult,
+		acted:       true,
+		jsonResult:  string(jsonResult),
+		textResult:  textResult,
+		auditTarget: auditTarget{bucket: attr.Bucket, name: attr.Name},
 	}
 
 	return &cr, nil
@@ -81,14 +87,17 @@ func (ce *ChillEffect) Enact(ctx context.Context, client *storage.Client, attr *
 
 // Internal copy object command for google storage.
 func (ce *ChillEffect) chillObject(ctx context.Context, client *storage.Client, attr *storage.ObjectAttrs) error {
-	return ce.actor(ctx, client, attr, ce.Config.ToStorageClass)
+	return ce.actor(ctx, client, attr, ce.Config.ToStorageClass, ce.stamp("chill"))
 }
 
-// ChillResult defines all outputs of a move effect.
+// ChillResult defines all outputs of a move effect, its audit target is the
+// object itself.
 type ChillResult struct {
 	acted      bool
+	skipped    bool
 	jsonResult string
 	textResult string
+	auditTarget
 }
 
 // HasActed is true if the effect was applied.
@@ -96,6 +105,11 @@ func (cr ChillResult) HasActed() bool {
 	return cr.acted
 }
 
+// Skipped is true if the object was left alone on purpose.
+func (cr ChillResult) Skipped() bool {
+	return cr.skipped
+}
+
 // JSONResult is the JSON result.
 func (cr ChillResult) JSONResult() string {
 	return cr.jsonResult
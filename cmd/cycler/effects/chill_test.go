@@ -15,7 +15,7 @@ import (
 
 func getChillMock(t *testing.T) interface{} {
 	return func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
-		toStorageClass cycler_pb.ChillEffectConfiguration_EnumStorageClass) error {
+		toStorageClass cycler_pb.ChillEffectConfiguration_EnumStorageClass, metadata map[string]string) error {
 		if toStorageClass != cycler_pb.ChillEffectConfiguration_COLDLINE {
 			t.Errorf("Wanted COLDLINE, got %+v", toStorageClass)
 		}
@@ -49,4 +49,27 @@ func TestChillEffect(t *testing.T) {
 	}
 }
 
-//TODO(engeg@) Add test we never call actor if storage class doesn't change.
+func TestChillEffectUnchanged(t *testing.T) {
+	config := &cycler_pb.ChillEffectConfiguration{
+		ToStorageClass: cycler_pb.ChillEffectConfiguration_COLDLINE,
+	}
+
+	ce := ChillEffect{}
+	ce.Initialize(config, func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
+		toStorageClass cycler_pb.ChillEffectConfiguration_EnumStorageClass, metadata map[string]string) error {
+		t.Error("actor called for an object already in the storage class")
+		return nil
+	})
+
+	chillResult, err := ce.Enact(context.Background(), nil, &storage.ObjectAttrs{StorageClass: "COLDLINE"})
+	if err != nil {
+		t.Errorf("chillResult returned an err:\n%+v", err)
+	}
+
+	if chillResult.HasActed() {
+		t.Error("chillResult.HasActed() returned true for an unchanged object")
+	}
+	if !chillResult.(SkippedResult).Skipped() {
+		t.Error("chillResult.Skipped() returned false for an unchanged object")
+	}
+}
@@ -48,7 +48,7 @@ func (de *DeleteEffect) Initialize(config interface{}, actor interface{}, checks
 func (de *DeleteEffect) Enact(ctx context.Context, client *storage.Client, attr *storage.ObjectAttrs) (EffectResult, error) {
 	err := de.deleteObject(ctx, client, attr)
 	if err != nil {
-		return nil, fmt.Errorf("Error deleting in DeleteEffect.enact: %v", err)
+		return nil, fmt.Errorf("Error deleting in DeleteEffect.enact: %w", err)
 	}
 
 	textResult := fmt.Sprintf("%+v", attr)
@@ -25,9 +25,10 @@ func (de DuplicateEffect) DefaultActor() interface{} {
 // DuplicateEffect runtime and configuration state.
 type DuplicateEffect struct {
 	Config *cycler_pb.DuplicateEffectConfiguration `json:"DuplicateEffectConfiguration"`
+	auditStamp
 	// Real or mock actor, non-test invocations use util.objectBucketToBucket.
 	actor func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
-		dstBucket string, prefix string, deleteAfter bool) error
+		dstBucket string, prefix string, deleteAfter bool, metadata map[string]string) error
 }
 
 // Init the DuplicateEffect, duplicate doesn't mutate so skip checks.
@@ -44,14 +45,14 @@ func (de *DuplicateEffect) Initialize(config interface{}, actor interface{}, che
 
 	de.Config = orig
 	de.actor = actor.(func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
-		dstBucket string, prefix string, deleteAfter bool) error)
+		dstBucket string, prefix string, deleteAfter bool, metadata map[string]string) error)
 }
 
 // Enact does the duplicate operation on the attr, does not mutate existing object.
 func (de *DuplicateEffect) Enact(ctx context.Context, client *storage.Client, attr *storage.ObjectAttrs) (EffectResult, error) {
 	err := de.duplicateObject(ctx, client, attr)
 	if err != nil {
-		return nil, fmt.Errorf("Error duplicating object in DuplicateEffect.enact: %v", err)
+		return nil, fmt.Errorf("Error duplicating object in DuplicateEffect.enact: %w", err)
 	}
 
 	textResult := fmt.Sprintf("%+v", attr)
@@ -63,20 +64,27 @@ func (de *DuplicateEffect) Enact(ctx context.Context, client *storage.Client, at
 		acted:      true,
 		jsonResult: string(jsonResult),
 		textResult: textResult,
+		auditTarget: auditTarget{
+			bucket: de.Config.DestinationBucket,
+			name:   de.Config.DestinationPrefix + attr.Name,
+		},
 	}
 	return &dr, nil
 }
 
 // Internal duplicate object command for google storage.
 func (de *DuplicateEffect) duplicateObject(ctx context.Context, client *storage.Client, attr *storage.ObjectAttrs) error {
-	return de.actor(ctx, client, attr, de.Config.DestinationBucket, de.Config.DestinationPrefix, false)
+	return de.actor(ctx, client, attr, de.Config.DestinationBucket, de.Config.DestinationPrefix, false,
+		de.stamp("duplicate"))
 }
 
-// DuplicateResult defines all outputs of an echo effect.
+// DuplicateResult defines all outputs of an echo effect, its audit target is
+// the copy, the duplicated object is left unchanged.
 type DuplicateResult struct {
 	acted      bool
 	jsonResult string
 	textResult string
+	auditTarget
 }
 
 // HasActed is true if the effect was applied.
@@ -15,7 +15,7 @@ import (
 
 func getDuplicateMock(t *testing.T) interface{} {
 	return func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
-		dstBucket string, prefix string, deleteAfter bool) error {
+		dstBucket string, prefix string, deleteAfter bool, metadata map[string]string) error {
 		if deleteAfter == true {
 			t.Errorf("Duplicate must not call with 'deleteAfter'")
 		}
@@ -25,3 +25,11 @@ type EffectResult interface {
 	JSONResult() string
 	TextResult() string
 }
+
+// SkippedResult is implemented by the results of effects that may leave a
+// matched object alone on purpose, e.g. because it is already up to date.
+type SkippedResult interface {
+	// Skipped is true if the effect didn't act on purpose, which is not a
+	// failure.
+	Skipped() bool
+}
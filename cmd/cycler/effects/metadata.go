@@ -0,0 +1,265 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package effects
+
+// Metadata sets custom metadata keys, cache-control and content-type on the
+// object in place, with values templated from the object's attributes.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"text/template"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+func (me MetadataEffect) DefaultActor() interface{} {
+	return objectUpdateAttrs
+}
+
+// MetadataEffectConfiguration configures the metadata effect. There is no
+// proto message for it, it is read from the extended effect configuration.
+//
+// Every value is a text/template executed with a MetadataTemplateInput, e.g.
+// "{{.Path.build_id}}" or "{{.Bucket}}-{{.StorageClass}}".
+type MetadataEffectConfiguration struct {
+	// Custom metadata keys to set, other existing keys are kept.
+	Metadata map[string]string `json:"metadata"`
+
+	// If set, the Cache-Control to set.
+	CacheControl string `json:"cache_control"`
+
+	// If set, the Content-Type to set.
+	ContentType string `json:"content_type"`
+
+	// If set, a regexp that every acted on object name must match. Its named
+	// groups are available to the templates in .Path.
+	NameRegexp string `json:"name_regexp"`
+}
+
+// MetadataTemplateInput is the data the metadata templates are executed with.
+type MetadataTemplateInput struct {
+	Bucket       string
+	Name         string
+	Size         int64
+	StorageClass string
+	ContentType  string
+	Created      time.Time
+	Metadata     map[string]string
+	Path         map[string]string
+}
+
+// MetadataEffect runtime and configuration state.
+type MetadataEffect struct {
+	Config *MetadataEffectConfiguration `json:"MetadataEffectConfiguration"`
+	auditStamp
+
+	// Parsed templates of the config.
+	metadata     map[string]*template.Template
+	cacheControl *template.Template
+	contentType  *template.Template
+	nameRegexp   *regexp.Regexp
+
+	// Real or mock actor, non-test invocations use util.objectUpdateAttrs.
+	actor func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
+		update storage.ObjectAttrsToUpdate) error
+}
+
+// Init the metadata effect.
+func (me *MetadataEffect) Initialize(config interface{}, actor interface{}, checks ...bool) {
+	orig, ok := config.(*MetadataEffectConfiguration)
+	if !ok {
+		log.Printf("Config could not be typecast: %+v", ok)
+		os.Exit(2)
+	}
+
+	// Validate the configuration.
+	if len(orig.Metadata) == 0 && orig.CacheControl == "" && orig.ContentType == "" {
+		log.Printf("Metadata effect configuration sets nothing.")
+		os.Exit(2)
+	}
+
+	var err error
+	me.metadata = make(map[string]*template.Template)
+	for key, value := range orig.Metadata {
+		if me.metadata[key], err = parseMetadataTemplate(key, value); err != nil {
+			log.Printf("%v", err)
+			os.Exit(2)
+		}
+	}
+	if me.cacheControl, err = parseMetadataTemplate("cache_control", orig.CacheControl); err != nil {
+		log.Printf("%v", err)
+		os.Exit(2)
+	}
+	if me.contentType, err = parseMetadataTemplate("content_type", orig.ContentType); err != nil {
+		log.Printf("%v", err)
+		os.Exit(2)
+	}
+	if orig.NameRegexp != "" {
+		if me.nameRegexp, err = regexp.Compile(orig.NameRegexp); err != nil {
+			log.Printf("Invalid name_regexp: %v", err)
+			os.Exit(2)
+		}
+	}
+
+	CheckMutationAllowed(checks)
+
+	me.Config = orig
+	me.actor = actor.(func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
+		update storage.ObjectAttrsToUpdate) error)
+}
+
+// parseMetadataTemplate parses value as a template, the empty value gives nil.
+func parseMetadataTemplate(name string, value string) (*template.Template, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := template.New(name).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid template for %v: %v", name, err)
+	}
+	return t, nil
+}
+
+// Enact updates the metadata of the attr. Objects already having the
+// configured values, or whose name doesn't match name_regexp, are left
+// untouched and not acted on.
+func (me *MetadataEffect) Enact(ctx context.Context, client *storage.Client, attr *storage.ObjectAttrs) (EffectResult, error) {
+	update, changed, err := me.attrsToUpdate(attr)
+	if err != nil {
+		return nil, fmt.Errorf("Error templating metadata of object (%v) in MetadataEffect.Enact: %v", attr.Name, err)
+	}
+	if !changed {
+		return &MetadataResult{skipped: true}, nil
+	}
+
+	me.stampUpdate(&update, "metadata")
+	if err := me.actor(ctx, client, attr, update); err != nil {
+		return nil, fmt.Errorf("Error updating metadata of object (%v) in MetadataEffect.Enact: %w", attr.Name, err)
+	}
+
+	textResult := fmt.Sprintf("%+v", attr)
+	jsonResult, err := json.Marshal(attr)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling json in MetadataEffect.Enact: %v", err)
+	}
+
+	mr := MetadataResult{
+		acted:       true,
+		jsonResult:  string(jsonResult),
+		textResult:  textResult,
+		auditTarget: auditTarget{bucket: attr.Bucket, name: attr.Name},
+	}
+	return &mr, nil
+}
+
+// attrsToUpdate renders the configured templates for attr, changed is false
+// if the object already has every rendered value or its name doesn't match
+// name_regexp.
+func (me *MetadataEffect) attrsToUpdate(attr *storage.ObjectAttrs) (storage.ObjectAttrsToUpdate, bool, error) {
+	update := storage.ObjectAttrsToUpdate{}
+	changed := false
+
+	input := MetadataTemplateInput{
+		Bucket:       attr.Bucket,
+		Name:         attr.Name,
+		Size:         attr.Size,
+		StorageClass: attr.StorageClass,
+		ContentType:  attr.ContentType,
+		Created:      attr.Created,
+		Metadata:     attr.Metadata,
+		Path:         make(map[string]string),
+	}
+	if me.nameRegexp != nil {
+		match := me.nameRegexp.FindStringSubmatch(attr.Name)
+		if match == nil {
+			return update, false, nil
+		}
+		for i, group := range me.nameRegexp.SubexpNames() {
+			if group != "" {
+				input.Path[group] = match[i]
+			}
+		}
+	}
+
+	for key, t := range me.metadata {
+		value, err := executeMetadataTemplate(t, input)
+		if err != nil {
+			return update, false, err
+		}
+		if current, ok := attr.Metadata[key]; !ok || current != value {
+			if update.Metadata == nil {
+				update.Metadata = make(map[string]string)
+			}
+			update.Metadata[key] = value
+			changed = true
+		}
+	}
+	if me.cacheControl != nil {
+		value, err := executeMetadataTemplate(me.cacheControl, input)
+		if err != nil {
+			return update, false, err
+		}
+		if attr.CacheControl != value {
+			update.CacheControl = value
+			changed = true
+		}
+	}
+	if me.contentType != nil {
+		value, err := executeMetadataTemplate(me.contentType, input)
+		if err != nil {
+			return update, false, err
+		}
+		if attr.ContentType != value {
+			update.ContentType = value
+			changed = true
+		}
+	}
+	return update, changed, nil
+}
+
+func executeMetadataTemplate(t *template.Template, input MetadataTemplateInput) (string, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, input); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// MetadataResult defines all outputs of a metadata effect, its audit target is
+// the object itself.
+type MetadataResult struct {
+	acted      bool
+	skipped    bool
+	jsonResult string
+	textResult string
+	auditTarget
+}
+
+// HasActed is true if the effect was applied.
+func (mr MetadataResult) HasActed() bool {
+	return mr.acted
+}
+
+// Skipped is true if the object was left alone on purpose.
+func (mr MetadataResult) Skipped() bool {
+	return mr.skipped
+}
+
+// JSONResult is the JSON result.
+func (mr MetadataResult) JSONResult() string {
+	return mr.jsonResult
+}
+
+// TextResult is the unformatted text result.
+func (mr MetadataResult) TextResult() string {
+	return mr.textResult
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package effects
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+func getMetadataMock(t *testing.T, calls *int) interface{} {
+	return func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
+		update storage.ObjectAttrsToUpdate) error {
+		*calls++
+		if update.Metadata["build_id"] != "8765" {
+			t.Errorf("Wanted build_id 8765, got %+v", update.Metadata)
+		}
+		if _, ok := update.Metadata["retention"]; ok {
+			t.Errorf("retention is unchanged and shouldn't be updated: %+v", update.Metadata)
+		}
+		if update.CacheControl != "no-cache" {
+			t.Errorf("Wanted cache control no-cache, got %+v", update.CacheControl)
+		}
+		if update.ContentType != nil {
+			t.Errorf("content type is unchanged and shouldn't be updated: %+v", update.ContentType)
+		}
+		return nil
+	}
+}
+
+func testMetadataConfig() *MetadataEffectConfiguration {
+	return &MetadataEffectConfiguration{
+		Metadata: map[string]string{
+			"build_id":  "{{.Path.build_id}}",
+			"retention": "{{.StorageClass}}",
+		},
+		CacheControl: "no-cache",
+		ContentType:  "text/plain",
+		NameRegexp:   `^builds/(?P<build_id>\d+)/`,
+	}
+}
+
+func TestMetadataEffect(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	me := MetadataEffect{}
+	me.Initialize(testMetadataConfig(), getMetadataMock(t, &calls))
+
+	attr := &storage.ObjectAttrs{
+		Bucket:       "test_bucket",
+		Name:         "builds/8765/test_object.txt",
+		StorageClass: "STANDARD",
+		ContentType:  "text/plain",
+		Metadata:     map[string]string{"retention": "STANDARD"},
+	}
+
+	client, err := storage.NewClient(ctx, option.WithoutAuthentication())
+	if err != nil {
+		t.Errorf("couldn't construct client: %v", err)
+	}
+
+	metadataResult, err := me.Enact(ctx, client, attr)
+	if err != nil {
+		t.Errorf("metadataResult returned an err:\n%+v", err)
+	}
+	if metadataResult.HasActed() != true {
+		t.Error("metadataResult.HasActed() returned false")
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 actor call, got %v", calls)
+	}
+}
+
+func TestMetadataEffectUnchanged(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	me := MetadataEffect{}
+	me.Initialize(testMetadataConfig(), getMetadataMock(t, &calls))
+
+	attr := &storage.ObjectAttrs{
+		Bucket:       "test_bucket",
+		Name:         "builds/8765/test_object.txt",
+		StorageClass: "STANDARD",
+		ContentType:  "text/plain",
+		CacheControl: "no-cache",
+		Metadata:     map[string]string{"retention": "STANDARD", "build_id": "8765"},
+	}
+
+	res, err := me.Enact(ctx, nil, attr)
+	if err != nil {
+		t.Errorf("metadataResult returned an err:\n%+v", err)
+	}
+	if res.HasActed() || !res.(SkippedResult).Skipped() {
+		t.Error("an up to date object should be skipped, not acted on")
+	}
+	if calls != 0 {
+		t.Errorf("expected no actor calls for an up to date object, got %v", calls)
+	}
+}
+
+func TestMetadataEffectNameMismatch(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	me := MetadataEffect{}
+	me.Initialize(testMetadataConfig(), getMetadataMock(t, &calls))
+
+	attr := &storage.ObjectAttrs{
+		Bucket: "test_bucket",
+		Name:   "logs/test_object.txt",
+	}
+
+	res, err := me.Enact(ctx, nil, attr)
+	if err != nil {
+		t.Errorf("metadataResult returned an err:\n%+v", err)
+	}
+	if res.HasActed() || !res.(SkippedResult).Skipped() {
+		t.Error("an object not matching name_regexp should be skipped, not acted on")
+	}
+	if calls != 0 {
+		t.Errorf("expected no actor calls, got %v", calls)
+	}
+}
@@ -25,9 +25,10 @@ func (me MoveEffect) DefaultActor() interface{} {
 // MoveEffect runtime and configuration state.
 type MoveEffect struct {
 	Config *cycler_pb.MoveEffectConfiguration `json:"MoveEffectConfiguration"`
+	auditStamp
 	// Real or mock actor, non-test invocations use util.objectBucketToBucket.
 	actor func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
-		dstBucket string, prefix string, deleteAfter bool) error
+		dstBucket string, prefix string, deleteAfter bool, metadata map[string]string) error
 }
 
 // MoveEffectConfig configuration.
@@ -48,7 +49,7 @@ func (me *MoveEffect) Initialize(config interface{}, actor interface{}, checks .
 
 	me.Config = orig
 	me.actor = actor.(func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
-		dstBucket string, prefix string, deleteAfter bool) error)
+		dstBucket string, prefix string, deleteAfter bool, metadata map[string]string) error)
 }
 
 // Enact does the move operation on the attr, _this deletes the old object_!
@@ -56,7 +57,7 @@ func (me *MoveEffect) Enact(ctx context.Context, client *storage.Client, attr *s
 	err := me.moveObject(ctx, client, attr)
 
 	if err != nil {
-		return nil, fmt.Errorf("Error moving object (%v) in moveEffect.Enact: %v", attr.Name, err)
+		return nil, fmt.Errorf("Error moving object (%v) in moveEffect.Enact: %w", attr.Name, err)
 	}
 
 	textResult := fmt.Sprintf("%+v", attr)
@@ -70,6 +71,10 @@ func (me *MoveEffect) Enact(ctx context.Context, client *storage.Client, attr *s
 		acted:      true,
 		jsonResult: string(jsonResult),
 		textResult: textResult,
+		auditTarget: auditTarget{
+			bucket: me.Config.DestinationBucket,
+			name:   me.Config.DestinationPrefix + attr.Name,
+		},
 	}
 
 	return &er, nil
@@ -77,14 +82,17 @@ func (me *MoveEffect) Enact(ctx context.Context, client *storage.Client, attr *s
 
 // Internal move object command for google storage.
 func (me *MoveEffect) moveObject(ctx context.Context, client *storage.Client, attr *storage.ObjectAttrs) error {
-	return me.actor(ctx, client, attr, me.Config.DestinationBucket, me.Config.DestinationPrefix, true)
+	return me.actor(ctx, client, attr, me.Config.DestinationBucket, me.Config.DestinationPrefix, true,
+		me.stamp("move"))
 }
 
-// MoveResult defines all outputs of a move effect.
+// MoveResult defines all outputs of a move effect, its audit target is the
+// moved object.
 type MoveResult struct {
 	acted      bool
 	jsonResult string
 	textResult string
+	auditTarget
 }
 
 // HasActed is true if the effect was applied.
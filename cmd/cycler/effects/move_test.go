@@ -15,7 +15,7 @@ import (
 
 func getMoveMock(t *testing.T) interface{} {
 	return func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
-		dstBucket string, prefix string, deleteAfter bool) error {
+		dstBucket string, prefix string, deleteAfter bool, metadata map[string]string) error {
 		if deleteAfter == false {
 			t.Errorf("Move must call with 'deleteAfter'")
 		}
@@ -51,4 +51,9 @@ func TestMoveEffect(t *testing.T) {
 	if moveResult.HasActed() != true {
 		t.Error("moveResult.HasActed() returned false")
 	}
+
+	// A move that doesn't act has failed, it never skips an object.
+	if _, ok := moveResult.(SkippedResult); ok {
+		t.Error("moveResult shouldn't report skips")
+	}
 }
@@ -0,0 +1,219 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package effects
+
+// Quarantine is a soft delete: the object is moved to a quarantine location,
+// its original location kept in metadata, and is only permanently deleted
+// once it has been in quarantine for the retention period. Run it over both
+// the source and the quarantine bucket to do both.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// Metadata keys set on quarantined objects.
+const (
+	QuarantineOriginalBucketKey = "cycler-original-bucket"
+	QuarantineOriginalNameKey   = "cycler-original-name"
+	QuarantineExpiresKey        = "cycler-quarantine-expires"
+)
+
+func (qe QuarantineEffect) DefaultActor() interface{} {
+	return QuarantineActors{
+		Quarantine: objectQuarantine,
+		Delete:     objectDelete,
+	}
+}
+
+// QuarantineActors are the real or mock operations of the quarantine effect.
+type QuarantineActors struct {
+	// Moves srcAttr to dstBucket/dstName, setting metadata on the copy.
+	Quarantine func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
+		dstBucket string, dstName string, metadata map[string]string) error
+
+	// Permanently deletes srcAttr.
+	Delete func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs) error
+}
+
+// QuarantineEffectConfiguration configures the quarantine effect. There is no
+// proto message for it, it is read from the extended effect configuration.
+type QuarantineEffectConfiguration struct {
+	// The bucket objects are quarantined in.
+	QuarantineBucket string `json:"quarantine_bucket"`
+
+	// The prefix under which objects are quarantined (e.g. quarantine/), the
+	// object is stored at <prefix><original bucket>/<original name>. Required,
+	// so quarantined objects can't be mistaken for the source objects.
+	QuarantinePrefix string `json:"quarantine_prefix"`
+
+	// The days an object stays in quarantine before it is deleted.
+	RetentionDays int64 `json:"retention_days"`
+}
+
+// QuarantineEffect runtime and configuration state.
+type QuarantineEffect struct {
+	Config *QuarantineEffectConfiguration `json:"QuarantineEffectConfiguration"`
+	auditStamp
+
+	// Real or mock actors, non-test invocations use util.objectQuarantine and
+	// util.objectDelete.
+	actors QuarantineActors
+
+	// Used instead of time.Now for ages and expiry, for tests.
+	now func() time.Time
+}
+
+// Init the quarantine effect.
+func (qe *QuarantineEffect) Initialize(config interface{}, actor interface{}, checks ...bool) {
+	orig, ok := config.(*QuarantineEffectConfiguration)
+	if !ok {
+		log.Printf("Config could not be typecast: %+v", ok)
+		os.Exit(2)
+	}
+
+	if err := orig.Validate(); err != nil {
+		log.Printf("%v", err)
+		os.Exit(2)
+	}
+
+	CheckMutationAllowed(checks)
+
+	qe.Config = orig
+	qe.actors = actor.(QuarantineActors)
+	qe.now = time.Now
+}
+
+// Validate checks the configuration is complete.
+func (c *QuarantineEffectConfiguration) Validate() error {
+	if c.QuarantineBucket == "" {
+		return errors.New("quarantine effect requires a quarantine_bucket")
+	}
+	if c.QuarantinePrefix == "" {
+		return errors.New("quarantine effect requires a quarantine_prefix")
+	}
+	if c.RetentionDays < 1 {
+		return errors.New("quarantine effect requires a positive retention_days")
+	}
+	return nil
+}
+
+// InQuarantine returns true if attr is an object in the quarantine location.
+// Not every such object was quarantined by the effect, see Quarantined.
+func (qe *QuarantineEffect) InQuarantine(attr *storage.ObjectAttrs) bool {
+	return attr.Bucket == qe.Config.QuarantineBucket &&
+		strings.HasPrefix(attr.Name, qe.Config.QuarantinePrefix)
+}
+
+// Quarantined returns true if attr is in the quarantine location and carries
+// the stamps of an object the effect quarantined.
+func (qe *QuarantineEffect) Quarantined(attr *storage.ObjectAttrs) bool {
+	if !qe.InQuarantine(attr) || attr.Metadata[QuarantineOriginalNameKey] == "" {
+		return false
+	}
+	_, err := time.Parse(time.RFC3339, attr.Metadata[QuarantineExpiresKey])
+	return err == nil
+}
+
+// Expired returns true if attr is a quarantined object past the expiry stamped
+// when it was quarantined, so changing retention_days only affects objects
+// quarantined afterwards.
+func (qe *QuarantineEffect) Expired(attr *storage.ObjectAttrs) bool {
+	if !qe.Quarantined(attr) {
+		return false
+	}
+	expires, _ := time.Parse(time.RFC3339, attr.Metadata[QuarantineExpiresKey])
+	return !qe.now().Before(expires)
+}
+
+func (qe *QuarantineEffect) retention() time.Duration {
+	return time.Duration(qe.Config.RetentionDays) * 24 * time.Hour
+}
+
+// quarantineName is the name attr is quarantined under.
+func (qe *QuarantineEffect) quarantineName(attr *storage.ObjectAttrs) string {
+	return qe.Config.QuarantinePrefix + attr.Bucket + "/" + attr.Name
+}
+
+// Enact quarantines the attr, or deletes it if it is a quarantined object
+// past its retention. Quarantined objects still within retention, and objects
+// in the quarantine location the effect didn't quarantine, are skipped.
+func (qe *QuarantineEffect) Enact(ctx context.Context, client *storage.Client, attr *storage.ObjectAttrs) (EffectResult, error) {
+	var target auditTarget
+	if qe.InQuarantine(attr) {
+		if !qe.Expired(attr) {
+			return &QuarantineResult{skipped: true}, nil
+		}
+		if err := qe.actors.Delete(ctx, client, attr); err != nil {
+			return nil, fmt.Errorf("Error deleting quarantined object (%v) in QuarantineEffect.Enact: %w", attr.Name, err)
+		}
+	} else {
+		metadata := map[string]string{
+			QuarantineOriginalBucketKey: attr.Bucket,
+			QuarantineOriginalNameKey:   attr.Name,
+			QuarantineExpiresKey:        qe.now().Add(qe.retention()).UTC().Format(time.RFC3339),
+		}
+		for k, v := range qe.stamp("quarantine") {
+			metadata[k] = v
+		}
+		target = auditTarget{bucket: qe.Config.QuarantineBucket, name: qe.quarantineName(attr)}
+		if err := qe.actors.Quarantine(ctx, client, attr, target.bucket, target.name, metadata); err != nil {
+			return nil, fmt.Errorf("Error quarantining object (%v) in QuarantineEffect.Enact: %w", attr.Name, err)
+		}
+	}
+
+	textResult := fmt.Sprintf("%+v", attr)
+	jsonResult, err := json.Marshal(attr)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling json in QuarantineEffect.Enact: %v", err)
+	}
+
+	qr := QuarantineResult{
+		acted:       true,
+		jsonResult:  string(jsonResult),
+		textResult:  textResult,
+		auditTarget: target,
+	}
+	return &qr, nil
+}
+
+// QuarantineResult defines all outputs of a quarantine effect, its audit
+// target is the quarantined object. Quarantined objects are deleted, which
+// leaves none.
+type QuarantineResult struct {
+	acted      bool
+	skipped    bool
+	jsonResult string
+	textResult string
+	auditTarget
+}
+
+// HasActed is true if the effect was applied.
+func (qr QuarantineResult) HasActed() bool {
+	return qr.acted
+}
+
+// Skipped is true if the object was left alone on purpose.
+func (qr QuarantineResult) Skipped() bool {
+	return qr.skipped
+}
+
+// JSONResult is the JSON result.
+func (qr QuarantineResult) JSONResult() string {
+	return qr.jsonResult
+}
+
+// TextResult is the unformatted text result.
+func (qr QuarantineResult) TextResult() string {
+	return qr.textResult
+}
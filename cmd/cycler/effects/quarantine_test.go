@@ -0,0 +1,114 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package effects
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+func TestQuarantineEffect(t *testing.T) {
+	now := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	quarantined := make(map[string]map[string]string)
+	deleted := make([]string, 0)
+	actors := QuarantineActors{
+		Quarantine: func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs,
+			dstBucket string, dstName string, metadata map[string]string) error {
+			if dstBucket != "quarantine_bucket" {
+				t.Errorf("quarantined to %v, expected quarantine_bucket", dstBucket)
+			}
+			quarantined[dstName] = metadata
+			return nil
+		},
+		Delete: func(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs) error {
+			deleted = append(deleted, srcAttr.Name)
+			return nil
+		},
+	}
+
+	config := &QuarantineEffectConfiguration{
+		QuarantineBucket: "quarantine_bucket",
+		QuarantinePrefix: "quarantine/",
+		RetentionDays:    30,
+	}
+	qe := QuarantineEffect{}
+	qe.Initialize(config, actors)
+	qe.now = func() time.Time { return now }
+
+	stamped := func(expires time.Time) map[string]string {
+		return map[string]string{
+			QuarantineOriginalNameKey: "a.txt",
+			QuarantineExpiresKey:      expires.Format(time.RFC3339),
+		}
+	}
+	objects := []struct {
+		attr  *storage.ObjectAttrs
+		acted bool
+	}{
+		{&storage.ObjectAttrs{Bucket: "test_bucket", Name: "a/test_object.txt", Created: now.AddDate(-1, 0, 0)}, true},
+		// Objects in the quarantine location without the stamps weren't
+		// quarantined by the effect, however old.
+		{&storage.ObjectAttrs{Bucket: "quarantine_bucket", Name: "quarantine/test_bucket/old.txt", Created: now.AddDate(0, 0, -31)}, false},
+		{&storage.ObjectAttrs{Bucket: "quarantine_bucket", Name: "quarantine/test_bucket/new.txt", Created: now.AddDate(0, 0, -1)}, false},
+		{&storage.ObjectAttrs{Bucket: "quarantine_bucket", Name: "quarantine/test_bucket/unnamed.txt",
+			Created: now.AddDate(0, 0, -31), Metadata: map[string]string{QuarantineExpiresKey: now.Format(time.RFC3339)}}, false},
+		// The stamped expiry wins over the configured retention.
+		{&storage.ObjectAttrs{Bucket: "quarantine_bucket", Name: "quarantine/test_bucket/kept.txt",
+			Created: now.AddDate(0, 0, -31), Metadata: stamped(now.AddDate(0, 0, 1))}, false},
+		{&storage.ObjectAttrs{Bucket: "quarantine_bucket", Name: "quarantine/test_bucket/expired.txt",
+			Created: now.AddDate(0, 0, -1), Metadata: stamped(now)}, true},
+	}
+	for _, o := range objects {
+		res, err := qe.Enact(context.Background(), nil, o.attr)
+		if err != nil {
+			t.Fatalf("quarantineResult returned an err:\n%+v", err)
+		}
+		if res.(SkippedResult).Skipped() == o.acted {
+			t.Errorf("quarantineResult.Skipped() for %v is %v, expected %v", o.attr.Name, o.acted, !o.acted)
+		}
+		if res.HasActed() != o.acted {
+			t.Errorf("quarantineResult.HasActed() for %v is %v, expected %v", o.attr.Name, res.HasActed(), o.acted)
+		}
+	}
+
+	metadata, ok := quarantined["quarantine/test_bucket/a/test_object.txt"]
+	if len(quarantined) != 1 || !ok {
+		t.Fatalf("expected the object quarantined with its path preserved, got %+v", quarantined)
+	}
+	if metadata[QuarantineOriginalBucketKey] != "test_bucket" ||
+		metadata[QuarantineOriginalNameKey] != "a/test_object.txt" ||
+		metadata[QuarantineExpiresKey] != "2021-03-31T00:00:00Z" {
+		t.Errorf("quarantine metadata not as expected: %+v", metadata)
+	}
+	if len(deleted) != 1 || deleted[0] != "quarantine/test_bucket/expired.txt" {
+		t.Errorf("expected only the expired quarantined objects deleted, got %v", deleted)
+	}
+}
+
+func TestQuarantineConfigValidate(t *testing.T) {
+	valid := QuarantineEffectConfiguration{
+		QuarantineBucket: "quarantine_bucket",
+		QuarantinePrefix: "quarantine/",
+		RetentionDays:    30,
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("valid config returned an err: %v", err)
+	}
+
+	noBucket, noPrefix, noRetention := valid, valid, valid
+	noBucket.QuarantineBucket = ""
+	noPrefix.QuarantinePrefix = ""
+	noRetention.RetentionDays = 0
+	for name, config := range map[string]QuarantineEffectConfiguration{
+		"no bucket": noBucket, "no prefix": noPrefix, "no retention": noRetention,
+	} {
+		if err := config.Validate(); err == nil {
+			t.Errorf("%v: expected an error", name)
+		}
+	}
+}
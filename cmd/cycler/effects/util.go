@@ -16,13 +16,19 @@ import (
 
 // Interbucket copy/move command for google storage, with optional delete.
 // prefix is joined added directly to every object name (e.g. 'backup/').
+// metadata, if any, is added to the copy's custom metadata.
 func objectBucketToBucket(ctx context.Context, client *storage.Client,
-	srcAttr *storage.ObjectAttrs, dstBucket string, prefix string, deleteAfter bool) error {
+	srcAttr *storage.ObjectAttrs, dstBucket string, prefix string, deleteAfter bool,
+	metadata map[string]string) error {
 
 	src := client.Bucket(srcAttr.Bucket).Object(srcAttr.Name)
 	dst := client.Bucket(dstBucket).Object(prefix + srcAttr.Name)
 
-	if _, err := dst.CopierFrom(src).Run(ctx); err != nil {
+	copier := dst.CopierFrom(src)
+	if len(metadata) > 0 {
+		keepAttrs(copier, srcAttr, metadata)
+	}
+	if _, err := copier.Run(ctx); err != nil {
 		return err
 	}
 	if deleteAfter {
@@ -31,9 +37,11 @@ func objectBucketToBucket(ctx context.Context, client *storage.Client,
 	return nil
 }
 
-// Change object storage class via copy with src and dst being the same.
+// Change object storage class via copy with src and dst being the same,
+// adding metadata to its custom metadata if there is any.
 func objectChangeStorageClass(ctx context.Context, client *storage.Client,
-	srcAttr *storage.ObjectAttrs, toStorageClass cycler_pb.ChillEffectConfiguration_EnumStorageClass) error {
+	srcAttr *storage.ObjectAttrs, toStorageClass cycler_pb.ChillEffectConfiguration_EnumStorageClass,
+	metadata map[string]string) error {
 
 	newStorageClass := cycler_pb.ChillEffectConfiguration_EnumStorageClass.String(toStorageClass)
 
@@ -45,6 +53,9 @@ func objectChangeStorageClass(ctx context.Context, client *storage.Client,
 	dst := client.Bucket(srcAttr.Bucket).Object(srcAttr.Name)
 
 	copier := dst.CopierFrom(src)
+	if len(metadata) > 0 {
+		keepAttrs(copier, srcAttr, metadata)
+	}
 	copier.StorageClass = newStorageClass
 
 	if _, err := copier.Run(ctx); err != nil {
@@ -53,6 +64,53 @@ func objectChangeStorageClass(ctx context.Context, client *storage.Client,
 	return nil
 }
 
+// Move the listed generation of srcAttr to dstBucket/dstName, keeping its
+// attributes and ACL and adding metadata to the copy's custom metadata. The
+// ACL can't be kept if dstBucket has uniform bucket-level access and srcAttr
+// has one, the copy fails rather than losing it. Only the generation copied
+// is deleted, one written since is left in place.
+func objectQuarantine(ctx context.Context, client *storage.Client,
+	srcAttr *storage.ObjectAttrs, dstBucket string, dstName string, metadata map[string]string) error {
+
+	src := client.Bucket(srcAttr.Bucket).Object(srcAttr.Name)
+	if srcAttr.Generation != 0 {
+		src = src.Generation(srcAttr.Generation)
+	}
+	dst := client.Bucket(dstBucket).Object(dstName)
+
+	copier := dst.CopierFrom(src)
+	keepAttrs(copier, srcAttr, metadata)
+	if len(srcAttr.ACL) > 0 {
+		copier.ACL = srcAttr.ACL
+	}
+
+	if _, err := copier.Run(ctx); err != nil {
+		return err
+	}
+	if srcAttr.Generation != 0 {
+		src = src.If(storage.Conditions{GenerationMatch: srcAttr.Generation})
+	}
+	return src.Delete(ctx)
+}
+
+// keepAttrs sets the attributes of srcAttr on copier, adding metadata to its
+// custom metadata. Setting any attribute on a copier replaces them all, so
+// they have to be carried over to set any.
+func keepAttrs(copier *storage.Copier, srcAttr *storage.ObjectAttrs, metadata map[string]string) {
+	copier.ContentType = srcAttr.ContentType
+	copier.ContentEncoding = srcAttr.ContentEncoding
+	copier.ContentLanguage = srcAttr.ContentLanguage
+	copier.ContentDisposition = srcAttr.ContentDisposition
+	copier.CacheControl = srcAttr.CacheControl
+	copier.Metadata = make(map[string]string)
+	for k, v := range srcAttr.Metadata {
+		copier.Metadata[k] = v
+	}
+	for k, v := range metadata {
+		copier.Metadata[k] = v
+	}
+}
+
 // Delete the provided srtAttr object.
 func objectDelete(ctx context.Context, client *storage.Client, srcAttr *storage.ObjectAttrs) error {
 	if err := client.Bucket(srcAttr.Bucket).Object(srcAttr.Name).Delete(ctx); err != nil {
@@ -61,6 +119,25 @@ func objectDelete(ctx context.Context, client *storage.Client, srcAttr *storage.
 	return nil
 }
 
+// Update the attributes of the listed generation of srcAttr, failing if its
+// metadata changed since it was listed. Such a failure is a precondition
+// error, which isn't retried as the listed attrs would fail the same way.
+func objectUpdateAttrs(ctx context.Context, client *storage.Client,
+	srcAttr *storage.ObjectAttrs, update storage.ObjectAttrsToUpdate) error {
+
+	obj := client.Bucket(srcAttr.Bucket).Object(srcAttr.Name)
+	if srcAttr.Generation != 0 {
+		obj = obj.Generation(srcAttr.Generation)
+	}
+	if srcAttr.Metageneration != 0 {
+		obj = obj.If(storage.Conditions{MetagenerationMatch: srcAttr.Metageneration})
+	}
+	if _, err := obj.Update(ctx, update); err != nil {
+		return err
+	}
+	return nil
+}
+
 // CheckMutationAllowed will exit if any check in checks is false.
 func CheckMutationAllowed(checks []bool) {
 	for _, check := range checks {
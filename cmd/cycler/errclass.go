@@ -0,0 +1,163 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+// Error classes, distinguishing errors retrying won't fix (e.g. a bucket
+// policy blocking us) from GCS being flaky.
+const (
+	errClassPermission   = "permission"
+	errClassNotFound     = "notFound"
+	errClassPrecondition = "precondition"
+	errClassRateLimit    = "rateLimit"
+	errClassTransient    = "transient"
+	errClassGuardrail    = "guardrail"
+	errClassCancelled    = "cancelled"
+	errClassOther        = "other"
+)
+
+// classifyError returns the class of an error from iterating or enacting.
+func classifyError(err error) string {
+	if errors.Is(err, errGuardrailExceeded) {
+		return errClassGuardrail
+	}
+	// Our own doing (e.g. a drain), not a failure of the object or of GCS.
+	if errors.Is(err, context.Canceled) {
+		return errClassCancelled
+	}
+	if isRateLimited(err) {
+		return errClassRateLimit
+	}
+	if errors.Is(err, storage.ErrObjectNotExist) || errors.Is(err, storage.ErrBucketNotExist) {
+		return errClassNotFound
+	}
+
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		switch {
+		case gerr.Code == http.StatusUnauthorized || gerr.Code == http.StatusForbidden:
+			return errClassPermission
+		case gerr.Code == http.StatusNotFound:
+			return errClassNotFound
+		case gerr.Code == http.StatusPreconditionFailed || gerr.Code == http.StatusConflict:
+			return errClassPrecondition
+		case gerr.Code == http.StatusRequestTimeout || gerr.Code >= 500:
+			return errClassTransient
+		}
+		return errClassOther
+	}
+
+	var nerr net.Error
+	if errors.As(err, &nerr) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return errClassTransient
+	}
+	return errClassOther
+}
+
+// ErrorStats counts errors by class, for both attempts that failed (and may
+// have been retried) and units that were abandoned.
+type ErrorStats struct {
+	ObjectFailures    map[string]int64 `json:"ObjectFailures"`
+	ObjectsAbandoned  map[string]int64 `json:"ObjectsAbandoned"`
+	PrefixFailures    map[string]int64 `json:"PrefixFailures"`
+	PrefixesAbandoned map[string]int64 `json:"PrefixesAbandoned"`
+
+	// Used to protect all members.
+	mux sync.Mutex
+}
+
+// NewErrorStats returns empty error stats.
+func NewErrorStats() *ErrorStats {
+	return &ErrorStats{
+		ObjectFailures:    make(map[string]int64),
+		ObjectsAbandoned:  make(map[string]int64),
+		PrefixFailures:    make(map[string]int64),
+		PrefixesAbandoned: make(map[string]int64),
+	}
+}
+
+// objectFailed counts a failed object attempt and returns the error's class.
+func (es *ErrorStats) objectFailed(err error, abandoned bool) string {
+	return es.record(es.ObjectFailures, es.ObjectsAbandoned, err, abandoned)
+}
+
+// prefixFailed counts a failed prefix listing and returns the error's class.
+func (es *ErrorStats) prefixFailed(err error, abandoned bool) string {
+	return es.record(es.PrefixFailures, es.PrefixesAbandoned, err, abandoned)
+}
+
+func (es *ErrorStats) record(failures map[string]int64, abandons map[string]int64,
+	err error, abandoned bool) string {
+
+	class := classifyError(err)
+	es.mux.Lock()
+	defer es.mux.Unlock()
+	failures[class]++
+	if abandoned {
+		abandons[class]++
+	}
+	return class
+}
+
+// textResult returns a text representation of the counters.
+func (es *ErrorStats) textResult() string {
+	es.mux.Lock()
+	defer es.mux.Unlock()
+	s := ""
+	s += "Object failures: " + countsString(es.ObjectFailures) + "\n"
+	s += "Objects abandoned: " + countsString(es.ObjectsAbandoned) + "\n"
+	s += "Prefix failures: " + countsString(es.PrefixFailures) + "\n"
+	s += "Prefixes abandoned: " + countsString(es.PrefixesAbandoned) + "\n"
+	return s
+}
+
+// countsString formats class counts in class order, e.g. "notFound 2, rateLimit 1".
+func countsString(counts map[string]int64) string {
+	if len(counts) == 0 {
+		return "none"
+	}
+	classes := make([]string, 0, len(counts))
+	for class := range counts {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	s := ""
+	for i, class := range classes {
+		if i > 0 {
+			s += ", "
+		}
+		s += fmt.Sprintf("%v %v", class, counts[class])
+	}
+	return s
+}
+
+// errorSummary returns the runlog record of the run's error counters.
+func errorSummary() ([]byte, error) {
+	record := map[string]interface{}{
+		"Event":        "ErrorSummary",
+		"InvocationID": cyclerInvocationID.String(),
+		"ErrorStats":   errorStats,
+	}
+	summary, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal error summary: %v", err)
+	}
+	return summary, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+func TestClassifyError(t *testing.T) {
+	wrap := func(err error) error {
+		return fmt.Errorf("error in Effect.Enact: %w", err)
+	}
+	cases := map[string]struct {
+		err   error
+		class string
+	}{
+		"forbidden":     {wrap(&googleapi.Error{Code: 403}), errClassPermission},
+		"unauthorized":  {&googleapi.Error{Code: 401}, errClassPermission},
+		"not found":     {wrap(&googleapi.Error{Code: 404}), errClassNotFound},
+		"no object":     {wrap(storage.ErrObjectNotExist), errClassNotFound},
+		"precondition":  {wrap(&googleapi.Error{Code: 412}), errClassPrecondition},
+		"rate limit":    {wrap(&googleapi.Error{Code: 429}), errClassRateLimit},
+		"rate reason":   {&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}, errClassRateLimit},
+		"server error":  {wrap(&googleapi.Error{Code: 503}), errClassTransient},
+		"network":       {wrap(&net.OpError{Op: "dial", Err: errors.New("connection refused")}), errClassTransient},
+		"deadline":      {wrap(context.DeadlineExceeded), errClassTransient},
+		"guardrail":     {fmt.Errorf("%w: delete count", errGuardrailExceeded), errClassGuardrail},
+		"cancelled":     {wrap(context.Canceled), errClassCancelled},
+		"bad request":   {&googleapi.Error{Code: 400}, errClassOther},
+		"unknown error": {errors.New("matched but did not act"), errClassOther},
+	}
+	for name, c := range cases {
+		if class := classifyError(c.err); class != c.class {
+			t.Errorf("%v: classifyError(%v) = %v, expected %v", name, c.err, class, c.class)
+		}
+	}
+}
+
+func TestErrorStats(t *testing.T) {
+	es := NewErrorStats()
+	es.objectFailed(&googleapi.Error{Code: 429}, false)
+	es.objectFailed(&googleapi.Error{Code: 403}, true)
+	es.prefixFailed(&googleapi.Error{Code: 503}, true)
+
+	if es.ObjectFailures[errClassRateLimit] != 1 || es.ObjectFailures[errClassPermission] != 1 {
+		t.Errorf("object failures not as expected: %v", es.ObjectFailures)
+	}
+	if len(es.ObjectsAbandoned) != 1 || es.ObjectsAbandoned[errClassPermission] != 1 {
+		t.Errorf("objects abandoned not as expected: %v", es.ObjectsAbandoned)
+	}
+	if es.PrefixesAbandoned[errClassTransient] != 1 {
+		t.Errorf("prefixes abandoned not as expected: %v", es.PrefixesAbandoned)
+	}
+
+	expected := "Object failures: permission 1, rateLimit 1\n" +
+		"Objects abandoned: permission 1\n" +
+		"Prefix failures: transient 1\n" +
+		"Prefixes abandoned: transient 1\n"
+	if text := es.textResult(); text != expected {
+		t.Errorf("textResult is:\n%v\nexpected:\n%v", text, expected)
+	}
+}
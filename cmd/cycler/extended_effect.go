@@ -0,0 +1,79 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"go.chromium.org/chromiumos/infra/go/cmd/cycler/effects"
+)
+
+// ExtendedEffectConfiguration configures effects that have no message in the
+// cycler PolicyEffectConfiguration proto. It is used by a policy whose
+// policy_effect_configuration sets no effect, exactly one field must be set.
+type ExtendedEffectConfiguration struct {
+	Metadata   *effects.MetadataEffectConfiguration   `json:"metadata,omitempty"`
+	ACL        *effects.ACLEffectConfiguration        `json:"acl,omitempty"`
+	Quarantine *effects.QuarantineEffectConfiguration `json:"quarantine,omitempty"`
+}
+
+// loadExtendedEffectConfig reads the extended effect configuration at path.
+func loadExtendedEffectConfig(path string) (*ExtendedEffectConfiguration, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read extended effect config: %v", err)
+	}
+	return parseExtendedEffectConfig(in)
+}
+
+// parseExtendedEffectConfig parses a json extended effect configuration.
+func parseExtendedEffectConfig(in []byte) (*ExtendedEffectConfiguration, error) {
+	config := &ExtendedEffectConfiguration{}
+	if err := json.Unmarshal(in, config); err != nil {
+		return nil, fmt.Errorf("extended effect config couldn't be unmarshaled: %v", err)
+	}
+	if _, _, err := config.effect(); err != nil {
+		return nil, err
+	}
+	if config.ACL != nil {
+		if err := config.ACL.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if config.Quarantine != nil {
+		if err := config.Quarantine.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// effect returns a new effect of the configured type and its configuration.
+func (ec *ExtendedEffectConfiguration) effect() (effects.Effect, interface{}, error) {
+	var effect effects.Effect
+	var config interface{}
+	set := 0
+	if ec.Metadata != nil {
+		effect, config = &effects.MetadataEffect{}, ec.Metadata
+		set++
+	}
+	if ec.ACL != nil {
+		effect, config = &effects.ACLEffect{}, ec.ACL
+		set++
+	}
+	if ec.Quarantine != nil {
+		effect, config = &effects.QuarantineEffect{}, ec.Quarantine
+		set++
+	}
+	// Additional effects here.
+	// ...
+
+	if set != 1 {
+		return nil, nil, fmt.Errorf("extended effect config must set exactly one effect, got %v", set)
+	}
+	return effect, config, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"go.chromium.org/chromiumos/infra/go/cmd/cycler/effects"
+)
+
+func TestParseExtendedEffectConfig(t *testing.T) {
+	config, err := parseExtendedEffectConfig([]byte(`{
+  "metadata": {
+    "metadata": {"build_id": "{{.Path.build_id}}"},
+    "cache_control": "no-cache",
+    "name_regexp": "^builds/(?P<build_id>[0-9]+)/"
+  }
+}`))
+	if err != nil {
+		t.Fatalf("parseExtendedEffectConfig returned an err: %v", err)
+	}
+	effect, effectConfig, err := config.effect()
+	if err != nil {
+		t.Fatalf("effect returned an err: %v", err)
+	}
+	if _, ok := effect.(*effects.MetadataEffect); !ok {
+		t.Errorf("expected a metadata effect, got %T", effect)
+	}
+	if mc, ok := effectConfig.(*effects.MetadataEffectConfiguration); !ok || mc.CacheControl != "no-cache" {
+		t.Errorf("metadata config not as expected: %+v", effectConfig)
+	}
+	if effectName(effect) != "metadata" {
+		t.Errorf("effect name is %v, expected metadata", effectName(effect))
+	}
+}
+
+func TestParseExtendedEffectConfigNoEffect(t *testing.T) {
+	if _, err := parseExtendedEffectConfig([]byte(`{}`)); err == nil {
+		t.Error("expected an error for a config setting no effect")
+	}
+}
+
+func TestParseExtendedEffectConfigACL(t *testing.T) {
+	config, err := parseExtendedEffectConfig([]byte(`{
+  "acl": {"rules": [{"prefix": "builds/", "min_age_days": 90, "predefined_acl": "projectPrivate"}]}
+}`))
+	if err != nil {
+		t.Fatalf("parseExtendedEffectConfig returned an err: %v", err)
+	}
+	if effect, _, _ := config.effect(); effectName(effect) != "acl" {
+		t.Errorf("expected an acl effect, got %T", effect)
+	}
+
+	// The pre-flight validation runs before any object is iterated.
+	if _, err := parseExtendedEffectConfig([]byte(`{
+  "acl": {"rules": [{"predefined_acl": "publicRead"}]}
+}`)); err == nil {
+		t.Error("expected an error for a config granting allUsers access")
+	}
+}
+
+func TestParseExtendedEffectConfigTwoEffects(t *testing.T) {
+	if _, err := parseExtendedEffectConfig([]byte(`{
+  "metadata": {"cache_control": "no-cache"},
+  "acl": {"rules": [{"predefined_acl": "projectPrivate"}]}
+}`)); err == nil {
+		t.Error("expected an error for a config setting two effects")
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"go.chromium.org/chromiumos/infra/go/cmd/cycler/effects"
+
+	"cloud.google.com/go/storage"
+)
+
+// errGuardrailExceeded is returned by admit when an action would cross a limit.
+var errGuardrailExceeded = errors.New("guardrail exceeded")
+
+// Guardrails bound the total cost of a run. Every action is admitted against
+// the configured limits before the effect is enacted, once any limit would be
+// exceeded the guardrails trip and the run is aborted. A limit of zero means
+// unlimited.
+type Guardrails struct {
+	// Limits, set at construction.
+	MaxObjectsMutated int64 `json:"MaxObjectsMutated"`
+	MaxBytesCopied    int64 `json:"MaxBytesCopied"`
+	MaxDeleteCount    int64 `json:"MaxDeleteCount"`
+
+	// Runtime counters of admitted actions.
+	ObjectsMutated int64 `json:"ObjectsMutated"`
+	BytesCopied    int64 `json:"BytesCopied"`
+	DeleteCount    int64 `json:"DeleteCount"`
+
+	// Reason is the first limit that tripped, empty if none has.
+	Reason string `json:"Reason,omitempty"`
+
+	// Tripped is closed when the first limit is exceeded.
+	Tripped chan bool `json:"-"`
+
+	once sync.Once
+}
+
+// actionCost is what a single enacted effect counts against the guardrails.
+type actionCost struct {
+	mutated int64
+	copied  int64
+	deleted int64
+}
+
+// NewGuardrails returns guardrails with the given limits (zero is unlimited).
+func NewGuardrails(maxObjectsMutated, maxBytesCopied, maxDeleteCount int64) *Guardrails {
+	return &Guardrails{
+		MaxObjectsMutated: maxObjectsMutated,
+		MaxBytesCopied:    maxBytesCopied,
+		MaxDeleteCount:    maxDeleteCount,
+		Tripped:           make(chan bool),
+	}
+}
+
+// costOf determines what enacting effect on attr will count against the limits.
+func costOf(effect effects.Effect, attr *storage.ObjectAttrs) actionCost {
+	switch e := effect.(type) {
+	case *effects.DuplicateEffect:
+		return actionCost{mutated: 1, copied: attr.Size}
+	case *effects.MoveEffect:
+		return actionCost{mutated: 1, copied: attr.Size, deleted: 1}
+	case *effects.ChillEffect:
+		// Storage class changes are a rewrite of the object in place.
+		return actionCost{mutated: 1, copied: attr.Size}
+	case *effects.DeleteEffect:
+		return actionCost{mutated: 1, deleted: 1}
+	case *effects.QuarantineEffect:
+		// Quarantining is undoable, only the final delete counts as one.
+		if e.Expired(attr) {
+			return actionCost{mutated: 1, deleted: 1}
+		} else if e.InQuarantine(attr) {
+			return actionCost{}
+		}
+		return actionCost{mutated: 1, copied: attr.Size}
+	case *effects.MetadataEffect, *effects.ACLEffect:
+		// Metadata and ACLs are patched in place, no object data is copied.
+		return actionCost{mutated: 1}
+	default:
+		return actionCost{}
+	}
+}
+
+// admit reserves the cost of an action. If any limit would be exceeded nothing
+// is reserved, the guardrails trip and errGuardrailExceeded is returned. Once
+// tripped no action is admitted, whatever its cost.
+func (g *Guardrails) admit(cost actionCost) error {
+	select {
+	case <-g.Tripped:
+		return fmt.Errorf("%w: run aborted, %v", errGuardrailExceeded, g.Reason)
+	default:
+	}
+	if err := reserve(&g.ObjectsMutated, cost.mutated, g.MaxObjectsMutated, "objects mutated"); err != nil {
+		return g.trip(err)
+	}
+	if err := reserve(&g.BytesCopied, cost.copied, g.MaxBytesCopied, "bytes copied"); err != nil {
+		atomic.AddInt64(&g.ObjectsMutated, -cost.mutated)
+		return g.trip(err)
+	}
+	if err := reserve(&g.DeleteCount, cost.deleted, g.MaxDeleteCount, "delete count"); err != nil {
+		atomic.AddInt64(&g.ObjectsMutated, -cost.mutated)
+		atomic.AddInt64(&g.BytesCopied, -cost.copied)
+		return g.trip(err)
+	}
+	return nil
+}
+
+// release returns a reservation made by admit, used when the effect failed.
+func (g *Guardrails) release(cost actionCost) {
+	atomic.AddInt64(&g.ObjectsMutated, -cost.mutated)
+	atomic.AddInt64(&g.BytesCopied, -cost.copied)
+	atomic.AddInt64(&g.DeleteCount, -cost.deleted)
+}
+
+// trip records the first exceeded limit and signals waiters on Tripped.
+func (g *Guardrails) trip(err error) error {
+	g.once.Do(func() {
+		g.Reason = err.Error()
+		close(g.Tripped)
+	})
+	return err
+}
+
+// reserve adds delta to counter unless it would pass max (zero is unlimited).
+func reserve(counter *int64, delta int64, max int64, name string) error {
+	if delta == 0 {
+		return nil
+	}
+	n := atomic.AddInt64(counter, delta)
+	if max > 0 && n > max {
+		atomic.AddInt64(counter, -delta)
+		return fmt.Errorf("%w: %v would reach %v, limit is %v", errGuardrailExceeded, name, n, max)
+	}
+	return nil
+}
+
+// textResult returns a text representation of the guardrail counters.
+func (g *Guardrails) textResult() string {
+	s := fmt.Sprintf("Objects mutated: %v (limit %v)\n", g.ObjectsMutated, limitString(g.MaxObjectsMutated))
+	s += fmt.Sprintf("Bytes copied: %v (limit %v)\n", g.BytesCopied, limitString(g.MaxBytesCopied))
+	s += fmt.Sprintf("Delete count: %v (limit %v)\n", g.DeleteCount, limitString(g.MaxDeleteCount))
+	if g.Reason != "" {
+		s += fmt.Sprintf("Run aborted: %v\n", g.Reason)
+	}
+	return s
+}
+
+func limitString(max int64) string {
+	if max <= 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%v", max)
+}
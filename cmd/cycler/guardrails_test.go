@@ -0,0 +1,119 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.chromium.org/chromiumos/infra/go/cmd/cycler/effects"
+
+	"cloud.google.com/go/storage"
+)
+
+func TestGuardrailsUnlimited(t *testing.T) {
+	g := NewGuardrails(0, 0, 0)
+	for i := 0; i < 100; i++ {
+		if err := g.admit(actionCost{mutated: 1, copied: 1024, deleted: 1}); err != nil {
+			t.Errorf("unlimited guardrails returned an err: %v", err)
+		}
+	}
+	if g.ObjectsMutated != 100 || g.BytesCopied != 102400 || g.DeleteCount != 100 {
+		t.Errorf("unexpected counters: %+v", g)
+	}
+}
+
+func TestGuardrailsTrip(t *testing.T) {
+	g := NewGuardrails(0, 0, 2)
+	cost := costOf(&effects.DeleteEffect{}, &storage.ObjectAttrs{Size: 10})
+
+	for i := 0; i < 2; i++ {
+		if err := g.admit(cost); err != nil {
+			t.Errorf("admit %v returned an err: %v", i, err)
+		}
+	}
+
+	err := g.admit(cost)
+	if !errors.Is(err, errGuardrailExceeded) {
+		t.Errorf("expected errGuardrailExceeded, got: %v", err)
+	}
+
+	select {
+	case <-g.Tripped:
+	default:
+		t.Error("Tripped was not closed")
+	}
+
+	// A rejected action must not be counted against any limit.
+	if g.ObjectsMutated != 2 || g.DeleteCount != 2 {
+		t.Errorf("rejected action was counted: %+v", g)
+	}
+	if g.Reason == "" {
+		t.Error("Reason was not recorded")
+	}
+
+	// Nothing is admitted once tripped, even actions under every limit.
+	if err := g.admit(costOf(&effects.ChillEffect{}, &storage.ObjectAttrs{Size: 10})); !errors.Is(err, errGuardrailExceeded) {
+		t.Errorf("expected errGuardrailExceeded after tripping, got: %v", err)
+	}
+}
+
+func TestGuardrailsRelease(t *testing.T) {
+	g := NewGuardrails(1, 0, 0)
+	cost := costOf(&effects.MoveEffect{}, &storage.ObjectAttrs{Size: 10})
+
+	if err := g.admit(cost); err != nil {
+		t.Errorf("admit returned an err: %v", err)
+	}
+	g.release(cost)
+	if err := g.admit(cost); err != nil {
+		t.Errorf("admit after release returned an err: %v", err)
+	}
+	if g.ObjectsMutated != 1 || g.BytesCopied != 10 || g.DeleteCount != 1 {
+		t.Errorf("unexpected counters: %+v", g)
+	}
+}
+
+func TestCostOfNoop(t *testing.T) {
+	if cost := costOf(&effects.NoopEffect{}, &storage.ObjectAttrs{Size: 10}); cost != (actionCost{}) {
+		t.Errorf("noop effect has a cost: %+v", cost)
+	}
+}
+
+func TestQuarantineCost(t *testing.T) {
+	qe := &effects.QuarantineEffect{}
+	qe.Initialize(&effects.QuarantineEffectConfiguration{
+		QuarantineBucket: "quarantine",
+		QuarantinePrefix: "q/",
+		RetentionDays:    30,
+	}, qe.DefaultActor())
+	stamped := func(expires time.Time) map[string]string {
+		return map[string]string{
+			effects.QuarantineOriginalNameKey: "a.txt",
+			effects.QuarantineExpiresKey:      expires.Format(time.RFC3339),
+		}
+	}
+
+	// Quarantining copies but isn't a delete, deleting an expired object is.
+	if cost := costOf(qe, &storage.ObjectAttrs{Bucket: "b", Size: 10, Created: time.Now()}); cost != (actionCost{mutated: 1, copied: 10}) {
+		t.Errorf("quarantine cost not as expected: %+v", cost)
+	}
+	expired := &storage.ObjectAttrs{Bucket: "quarantine", Name: "q/b/a.txt", Size: 10,
+		Metadata: stamped(time.Now().AddDate(0, 0, -1))}
+	if cost := costOf(qe, expired); cost != (actionCost{mutated: 1, deleted: 1}) {
+		t.Errorf("expired quarantine cost not as expected: %+v", cost)
+	}
+	kept := &storage.ObjectAttrs{Bucket: "quarantine", Name: "q/b/a.txt", Size: 10,
+		Metadata: stamped(time.Now().AddDate(0, 0, 1))}
+	if cost := costOf(qe, kept); cost != (actionCost{}) {
+		t.Errorf("quarantined object has a cost: %+v", cost)
+	}
+	unstamped := &storage.ObjectAttrs{Bucket: "quarantine", Name: "q/b/a.txt", Size: 10,
+		Created: time.Now().AddDate(0, 0, -31)}
+	if cost := costOf(qe, unstamped); cost != (actionCost{}) {
+		t.Errorf("object the effect didn't quarantine has a cost: %+v", cost)
+	}
+}
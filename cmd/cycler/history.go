@@ -0,0 +1,171 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// HISTORY_USAGE is printed by the history subcommand's flags on --help.
+const HISTORY_USAGE = `
+cycler history [flags] <runlog> <gs://bucket/name>
+
+Prints the mutation history of an object, oldest first, from the runlogs of
+every invocation under <runlog> (a gs:// or local directory, i.e. the runlog
+destination of the runs). The history includes the move, duplicate or
+quarantine that left the object at its name. Runlogs written before the
+effect was recorded list every action on the object, without an effect.
+
+Objects mutated by runs with --auditStamp carry the uuid of the invocation
+that last mutated them in their cycler-invocation metadata.
+`
+
+// HistoryEntry is a single mutation in the history of an object.
+type HistoryEntry struct {
+	InvocationID string    `json:"InvocationID"`
+	ActionTime   time.Time `json:"ActionTime"`
+	Effect       string    `json:"Effect"`
+
+	// The object acted on, and the object the effect left if it was elsewhere.
+	Object      string `json:"Object"`
+	AuditTarget string `json:"AuditTarget,omitempty"`
+}
+
+// historyRecord is the part of a runlog line that makes up a history entry.
+type historyRecord struct {
+	InputObject *struct {
+		Attr *struct {
+			Bucket string `json:"Bucket"`
+			Name   string `json:"Name"`
+		} `json:"attr"`
+	} `json:"InputObject"`
+	ActionTime   time.Time `json:"ActionTime"`
+	Effect       string    `json:"Effect"`
+	InvocationID string    `json:"InvocationID"`
+	AuditTarget  string    `json:"AuditTarget"`
+}
+
+// historyMain runs the history subcommand with args and returns the exit code.
+func historyMain(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Printf("%v\n", HISTORY_USAGE)
+		fs.PrintDefaults()
+	}
+	jsonOutFile := fs.String("jsonOutFile", "", "set if the history should be "+
+		"written to a json file instead of plain text to stdout.")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	ctx := context.Background()
+	var client *storage.Client
+	if strings.HasPrefix(fs.Arg(0), "gs://") {
+		var err error
+		if client, err = storage.NewClient(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Google Cloud client couldn't be constructed: %v\n", err)
+			return 2
+		}
+	}
+	history, err := objectHistory(ctx, client, fs.Arg(0), strings.TrimPrefix(fs.Arg(1), "gs://"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	if *jsonOutFile != "" {
+		jsonBytes, err := json.Marshal(history)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: json marshalling failed: %v\n", err)
+			return 1
+		}
+		if err := ioutil.WriteFile(*jsonOutFile, jsonBytes, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: json output write failed: %v\n", err)
+			return 1
+		}
+	} else {
+		fmt.Print(historyTextResult(history))
+	}
+	return 0
+}
+
+// objectHistory returns the entries of the runlog at p that mutated or left
+// the object bucket/name, sorted by time. Records of effects that neither
+// deleted nor left an object (e.g. noop) aren't mutations, the quarantine
+// effect leaves an object or deletes an expired one. Records written before
+// the effect was recorded are taken as mutations of the object acted on.
+func objectHistory(ctx context.Context, client *storage.Client, p string, object string) ([]*HistoryEntry, error) {
+	history := make([]*HistoryEntry, 0)
+	err := scanRunlog(ctx, client, p, func(name string, line []byte) error {
+		var record historyRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("runlog %v has a bad record: %v", name, err)
+		}
+		if record.InputObject == nil || record.InputObject.Attr == nil {
+			return nil
+		}
+		deleted := record.Effect == "delete" || record.Effect == "quarantine"
+		if record.Effect != "" && !deleted && record.AuditTarget == "" {
+			return nil
+		}
+		attr := record.InputObject.Attr
+		source := attr.Bucket + "/" + attr.Name
+		if source != object && record.AuditTarget != object {
+			return nil
+		}
+
+		entry := &HistoryEntry{
+			InvocationID: record.InvocationID,
+			ActionTime:   record.ActionTime,
+			Effect:       record.Effect,
+			Object:       source,
+		}
+		// Runlogs written before the invocation was recorded are still in a
+		// directory named by it.
+		if entry.InvocationID == "" {
+			entry.InvocationID = path.Base(path.Dir(filepath.ToSlash(name)))
+		}
+		if record.AuditTarget != source {
+			entry.AuditTarget = record.AuditTarget
+		}
+		history = append(history, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].ActionTime.Before(history[j].ActionTime)
+	})
+	return history, nil
+}
+
+// historyTextResult is the plain text form of a history.
+func historyTextResult(history []*HistoryEntry) string {
+	s := fmt.Sprintf("Mutations: %v\n", len(history))
+	for _, entry := range history {
+		s += fmt.Sprintf("  %v %v %v gs://%v", entry.ActionTime.UTC().Format(time.RFC3339),
+			entry.InvocationID, entry.Effect, entry.Object)
+		if entry.AuditTarget != "" {
+			s += fmt.Sprintf(" -> gs://%v", entry.AuditTarget)
+		}
+		s += "\n"
+	}
+	return s
+}
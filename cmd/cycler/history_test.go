@@ -0,0 +1,82 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+func mutated(bucket string, name string, effect string, invocationID string, at time.Time,
+	target string) PolicyResult {
+
+	return PolicyResult{
+		InputObject: map[string]interface{}{
+			"attr": &storage.ObjectAttrs{Bucket: bucket, Name: name},
+		},
+		ActionTime:   at,
+		Effect:       effect,
+		InvocationID: invocationID,
+		AuditTarget:  target,
+	}
+}
+
+func TestObjectHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	t0 := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	// The later run is written first, the history is sorted by time.
+	writeRunlog(t, dir, "inv-2",
+		mutated("bkt", "a.txt", "chill", "inv-2", t0.AddDate(0, 0, 7), "bkt/a.txt"),
+		mutated("bkt", "b.txt", "chill", "inv-2", t0.AddDate(0, 0, 7), "bkt/b.txt"),
+		mutated("bkt", "a.txt", "noop", "inv-2", t0.AddDate(0, 0, 8), ""),
+		mutated("bkt", "a.txt", "delete", "inv-2", t0.AddDate(0, 0, 9), ""),
+		mutated("q", "q/bkt/c.txt", "quarantine", "inv-2", t0.AddDate(0, 0, 9), ""),
+		map[string]interface{}{"Event": "ErrorSummary"})
+	// An older runlog without invocation ids, which come from the directory.
+	writeRunlog(t, dir, "inv-1",
+		mutated("src", "a.txt", "move", "", t0, "bkt/a.txt"),
+		mutated("src", "c.txt", "move", "", t0, "bkt/c.txt"))
+	// One older still, without effects, whose actions are all mutations.
+	writeRunlog(t, dir, "inv-0",
+		mutated("bkt", "a.txt", "", "", t0.AddDate(0, 0, -1), ""),
+		mutated("bkt", "b.txt", "", "", t0.AddDate(0, 0, -1), ""))
+
+	history, err := objectHistory(context.Background(), nil, dir, "bkt/a.txt")
+	if err != nil {
+		t.Fatalf("objectHistory returned an err: %v", err)
+	}
+	expected := []HistoryEntry{
+		{InvocationID: "inv-0", ActionTime: t0.AddDate(0, 0, -1), Object: "bkt/a.txt"},
+		{InvocationID: "inv-1", ActionTime: t0, Effect: "move", Object: "src/a.txt", AuditTarget: "bkt/a.txt"},
+		{InvocationID: "inv-2", ActionTime: t0.AddDate(0, 0, 7), Effect: "chill", Object: "bkt/a.txt"},
+		{InvocationID: "inv-2", ActionTime: t0.AddDate(0, 0, 9), Effect: "delete", Object: "bkt/a.txt"},
+	}
+	if len(history) != len(expected) {
+		t.Fatalf("expected %v entries, got %+v", len(expected), history)
+	}
+	for i := range expected {
+		if *history[i] != expected[i] {
+			t.Errorf("entry %v is %+v, expected %+v", i, *history[i], expected[i])
+		}
+	}
+
+	// The deletion of an expired quarantined object leaves no target.
+	if history, err = objectHistory(context.Background(), nil, dir, "q/q/bkt/c.txt"); err != nil || len(history) != 1 {
+		t.Errorf("expected the quarantine deletion, got %+v, %v", history, err)
+	}
+	if history, err = objectHistory(context.Background(), nil, dir, "bkt/d.txt"); err != nil || len(history) != 0 {
+		t.Errorf("expected no history for an object never acted on, got %+v, %v", history, err)
+	}
+}
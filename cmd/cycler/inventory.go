@@ -0,0 +1,267 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+)
+
+// inventorySchema is the Avro schema of an InventoryRecord. Times are
+// timestamp-micros, load into BigQuery with --use_avro_logical_types.
+const inventorySchema = `{"type": "record", "name": "CyclerObject", "namespace": "cycler", "fields": [
+  {"name": "bucket", "type": "string"},
+  {"name": "name", "type": "string"},
+  {"name": "size", "type": "long"},
+  {"name": "created", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+  {"name": "updated", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+  {"name": "age_days", "type": "long"},
+  {"name": "storage_class", "type": "string"},
+  {"name": "content_type", "type": "string"},
+  {"name": "generation", "type": "long"},
+  {"name": "metadata", "type": {"type": "map", "values": "string"}}
+]}`
+
+// InventoryRecord is the inventory row of a single object.
+type InventoryRecord struct {
+	Bucket       string
+	Name         string
+	Size         int64
+	Created      time.Time
+	Updated      time.Time
+	AgeDays      int64
+	StorageClass string
+	ContentType  string
+	Generation   int64
+	Metadata     map[string]string
+}
+
+// newInventoryRecord returns the record of attr.
+func newInventoryRecord(attr *storage.ObjectAttrs) *InventoryRecord {
+	// Objects created in the future (clock skew) are inventoried as new.
+	age, err := AgeInDays(attr.Created)
+	if err != nil {
+		age = 0
+	}
+	return &InventoryRecord{
+		Bucket:       attr.Bucket,
+		Name:         attr.Name,
+		Size:         attr.Size,
+		Created:      attr.Created,
+		Updated:      attr.Updated,
+		AgeDays:      age,
+		StorageClass: attr.StorageClass,
+		ContentType:  attr.ContentType,
+		Generation:   attr.Generation,
+		Metadata:     attr.Metadata,
+	}
+}
+
+// appendAvro appends the record in the field order of inventorySchema.
+func (ir *InventoryRecord) appendAvro(b *bytes.Buffer) {
+	appendAvroString(b, ir.Bucket)
+	appendAvroString(b, ir.Name)
+	appendAvroLong(b, ir.Size)
+	appendAvroLong(b, timestampMicros(ir.Created))
+	appendAvroLong(b, timestampMicros(ir.Updated))
+	appendAvroLong(b, ir.AgeDays)
+	appendAvroString(b, ir.StorageClass)
+	appendAvroString(b, ir.ContentType)
+	appendAvroLong(b, ir.Generation)
+	keys := make([]string, 0, len(ir.Metadata))
+	for k := range ir.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	appendAvroStringMap(b, ir.Metadata, keys)
+}
+
+// timestampMicros is t in microseconds since the epoch, zero for a zero t.
+func timestampMicros(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Microsecond)
+}
+
+// Inventory writes a record of every object of the run, instead of running
+// effects, to sharded Avro files at <url>/<invocation id>/inventory-N.avro for
+// offline analysis. Unlike the GCS inventory reports it includes the custom
+// metadata and is as current as the run.
+type Inventory struct {
+	// The number of objects and shards written.
+	Objects int64 `json:"Objects"`
+	Shards  int64 `json:"Shards"`
+
+	// The objects of shards that couldn't be written.
+	ObjectsLost int64 `json:"ObjectsLost"`
+
+	// The objects per shard.
+	shardSize int
+
+	// The gs:// or file:// url and directory of the shards.
+	dstURL *url.URL
+	dir    string
+
+	// gcp client, set on init.
+	client *storage.Client
+
+	// Guards records and shard.
+	mu      sync.Mutex
+	records []*InventoryRecord
+	shard   int
+}
+
+// Init validates the destination url and sets up the inventory, exiting on a
+// bad configuration.
+func (inv *Inventory) Init(dstURL string, shardSize int64, client *storage.Client, invocationID uuid.UUID) {
+	u, err := url.Parse(dstURL)
+	if err != nil || (u.Scheme != "gs" && u.Scheme != "file") {
+		glog.Errorf("unexpected inventory destination %v (accepts file:// and gs://)", dstURL)
+		os.Exit(2)
+	}
+	if shardSize < 1 {
+		glog.Errorf("inventory shard size must be positive, got %v", shardSize)
+		os.Exit(2)
+	}
+
+	inv.dstURL = u
+	inv.dir = path.Join("/", u.Path, invocationID.String())
+	inv.shardSize = int(shardSize)
+	inv.client = client
+	inv.records = make([]*InventoryRecord, 0, inv.shardSize)
+}
+
+// add records attr, writing a shard once there are shardSize records.
+func (inv *Inventory) add(ctx context.Context, attr *storage.ObjectAttrs) {
+	inv.mu.Lock()
+	inv.records = append(inv.records, newInventoryRecord(attr))
+	if len(inv.records) < inv.shardSize {
+		inv.mu.Unlock()
+		return
+	}
+	records, shard := inv.takeShard()
+	inv.mu.Unlock()
+
+	// Written without holding the lock so other workers aren't blocked.
+	inv.writeShard(ctx, records, shard)
+}
+
+// takeShard returns the buffered records and their shard number, inv.mu must
+// be held.
+func (inv *Inventory) takeShard() ([]*InventoryRecord, int) {
+	records, shard := inv.records, inv.shard
+	inv.records = make([]*InventoryRecord, 0, inv.shardSize)
+	inv.shard++
+	return records, shard
+}
+
+// close writes the last, partial, shard.
+func (inv *Inventory) close(ctx context.Context) {
+	inv.mu.Lock()
+	records, shard := inv.takeShard()
+	inv.mu.Unlock()
+	if len(records) > 0 {
+		inv.writeShard(ctx, records, shard)
+	}
+}
+
+// writeShard writes records as shard, retrying failures retryCount times.
+func (inv *Inventory) writeShard(ctx context.Context, records []*InventoryRecord, shard int) {
+	var b bytes.Buffer
+	if err := encodeInventory(&b, records, uuid.New()); err != nil {
+		glog.Errorf("couldn't encode inventory shard %v: %v", shard, err)
+		atomic.AddInt64(&inv.ObjectsLost, int64(len(records)))
+		return
+	}
+
+	name := path.Join(inv.dir, fmt.Sprintf("inventory-%05d.avro", shard))
+	sleepTime := 2 * time.Second
+	for n := 0; ; n++ {
+		err := inv.persist(ctx, name, b.Bytes())
+		if err == nil {
+			break
+		}
+		if n >= retryCount {
+			glog.Errorf("couldn't write inventory shard %v, %v objects lost: %v", name, len(records), err)
+			atomic.AddInt64(&inv.ObjectsLost, int64(len(records)))
+			return
+		}
+		glog.V(0).Infof("retrying failed inventory write %v: %v\nsleeping for %v...", n, err, sleepTime)
+		time.Sleep(sleepTime)
+		sleepTime <<= 1
+	}
+	glog.V(1).Infof("inventory shard written: %v", name)
+	atomic.AddInt64(&inv.Objects, int64(len(records)))
+	atomic.AddInt64(&inv.Shards, 1)
+}
+
+// persist writes data to name at the destination.
+func (inv *Inventory) persist(ctx context.Context, name string, data []byte) error {
+	switch inv.dstURL.Scheme {
+	case "gs":
+		// Path has a leading / and we omit it.
+		w := inv.client.Bucket(inv.dstURL.Host).Object(name[1:]).NewWriter(ctx)
+		w.ContentType = "avro/binary"
+		if _, err := w.Write(data); err != nil {
+			w.Close()
+			return err
+		}
+		return w.Close()
+	default:
+		if err := os.MkdirAll(path.Dir(name), os.ModePerm); err != nil {
+			return err
+		}
+		f, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+}
+
+// encodeInventory writes records as an Avro object container file to b.
+func encodeInventory(b *bytes.Buffer, records []*InventoryRecord, sync [16]byte) error {
+	aw, err := newAvroWriter(b, inventorySchema, sync)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := aw.append(record); err != nil {
+			return err
+		}
+	}
+	return aw.close()
+}
+
+// jsonResult is the inventory summary as json.
+func (inv *Inventory) jsonResult() ([]byte, error) {
+	return json.Marshal(inv)
+}
+
+// textResult is the inventory summary as text.
+func (inv *Inventory) textResult() string {
+	s := fmt.Sprintf("Inventory %v://%v%v\nObjects: %v\nShards: %v\nObjects lost: %v\n",
+		inv.dstURL.Scheme, inv.dstURL.Host, inv.dir, inv.Objects, inv.Shards, inv.ObjectsLost)
+	s += errorStats.textResult()
+	return s
+}
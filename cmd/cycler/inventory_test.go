@@ -0,0 +1,179 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/google/uuid"
+)
+
+// avroReader decodes what encodeInventory writes, for tests.
+type avroReader struct {
+	t *testing.T
+	r *bufio.Reader
+}
+
+func (ar *avroReader) long() int64 {
+	v, err := binary.ReadVarint(ar.r)
+	if err != nil {
+		ar.t.Fatalf("couldn't read long: %v", err)
+	}
+	return v
+}
+
+func (ar *avroReader) bytes(n int64) []byte {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(ar.r, b); err != nil {
+		ar.t.Fatalf("couldn't read %v bytes: %v", n, err)
+	}
+	return b
+}
+
+func (ar *avroReader) string() string {
+	return string(ar.bytes(ar.long()))
+}
+
+// readInventory returns the schema and records of an inventory file.
+func readInventory(t *testing.T, data []byte) (string, []*InventoryRecord) {
+	ar := &avroReader{t: t, r: bufio.NewReader(bytes.NewReader(data))}
+	if magic := ar.bytes(4); !bytes.Equal(magic, avroMagic) {
+		t.Fatalf("bad magic: %v", magic)
+	}
+	meta := make(map[string]string)
+	for n := ar.long(); n != 0; n = ar.long() {
+		for i := int64(0); i < n; i++ {
+			meta[ar.string()] = ar.string()
+		}
+	}
+	if meta["avro.codec"] != "deflate" {
+		t.Errorf("expected the deflate codec, got %+v", meta)
+	}
+	sync := ar.bytes(16)
+
+	records := make([]*InventoryRecord, 0)
+	for {
+		if _, err := ar.r.Peek(1); err == io.EOF {
+			break
+		}
+		count := ar.long()
+		block, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(ar.bytes(ar.long()))))
+		if err != nil {
+			t.Fatalf("couldn't inflate block: %v", err)
+		}
+		if marker := ar.bytes(16); !bytes.Equal(marker, sync) {
+			t.Fatalf("bad sync marker: %v", marker)
+		}
+
+		br := &avroReader{t: t, r: bufio.NewReader(bytes.NewReader(block))}
+		for i := int64(0); i < count; i++ {
+			ir := &InventoryRecord{
+				Bucket:       br.string(),
+				Name:         br.string(),
+				Size:         br.long(),
+				Created:      time.Unix(0, br.long()*int64(time.Microsecond)).UTC(),
+				Updated:      time.Unix(0, br.long()*int64(time.Microsecond)).UTC(),
+				AgeDays:      br.long(),
+				StorageClass: br.string(),
+				ContentType:  br.string(),
+				Generation:   br.long(),
+				Metadata:     make(map[string]string),
+			}
+			for n := br.long(); n != 0; n = br.long() {
+				for j := int64(0); j < n; j++ {
+					ir.Metadata[br.string()] = br.string()
+				}
+			}
+			records = append(records, ir)
+		}
+	}
+	return meta["avro.schema"], records
+}
+
+func TestEncodeInventory(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	attr := &storage.ObjectAttrs{
+		Bucket:       "bkt",
+		Name:         "builds/1/image.bin",
+		Size:         1234,
+		Created:      now.AddDate(0, 0, -10),
+		Updated:      now.AddDate(0, 0, -9),
+		StorageClass: "NEARLINE",
+		ContentType:  "application/octet-stream",
+		Generation:   42,
+		Metadata:     map[string]string{"cycler-effect": "chill", "build_id": "1"},
+	}
+	records := make([]*InventoryRecord, 0)
+	for i := 0; i < avroBlockRecords+1; i++ {
+		records = append(records, newInventoryRecord(attr))
+	}
+	if records[0].AgeDays != 10 {
+		t.Errorf("expected age 10, got %v", records[0].AgeDays)
+	}
+
+	var b bytes.Buffer
+	if err := encodeInventory(&b, records, uuid.New()); err != nil {
+		t.Fatalf("encodeInventory returned an err: %v", err)
+	}
+	schema, decoded := readInventory(t, b.Bytes())
+	if !json.Valid([]byte(schema)) {
+		t.Errorf("schema isn't valid json: %v", schema)
+	}
+	if len(decoded) != len(records) {
+		t.Fatalf("expected %v records, got %v", len(records), len(decoded))
+	}
+	if !reflect.DeepEqual(decoded[len(decoded)-1], records[0]) {
+		t.Errorf("decoded record is %+v, expected %+v", decoded[len(decoded)-1], records[0])
+	}
+}
+
+func TestInventoryShards(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inventory_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	invocationID := uuid.New()
+	inv := &Inventory{}
+	inv.Init("file://"+dir, 2, nil, invocationID)
+
+	ctx := context.Background()
+	for _, name := range []string{"a", "b", "c"} {
+		inv.add(ctx, &storage.ObjectAttrs{Bucket: "bkt", Name: name, Created: time.Now()})
+	}
+	inv.close(ctx)
+
+	if inv.Objects != 3 || inv.Shards != 2 || inv.ObjectsLost != 0 {
+		t.Errorf("inventory counts not as expected: %+v", inv)
+	}
+	names := []string{}
+	for _, shard := range []string{"inventory-00000.avro", "inventory-00001.avro"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, invocationID.String(), shard))
+		if err != nil {
+			t.Fatalf("couldn't read shard: %v", err)
+		}
+		_, records := readInventory(t, data)
+		for _, record := range records {
+			names = append(names, record.Name)
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Errorf("inventoried objects not as expected: %v", names)
+	}
+}
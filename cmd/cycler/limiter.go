@@ -0,0 +1,209 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.chromium.org/chromiumos/infra/go/cmd/cycler/effects"
+
+	"google.golang.org/api/googleapi"
+)
+
+// EffectLimiter bounds the number of concurrent enactments of one effect type.
+// The workerJobs routines are shared by all effects, the limiter keeps an
+// expensive effect (e.g. cross region copies) from occupying all of them.
+// Workers wait for a slot of their object's effect, every slot is held by a
+// worker enacting the effect so the wait is bounded by the enactments in
+// progress.
+//
+// The limit adapts: every rate limit error from the effect halves it, and it
+// grows back by one after a limit's worth of consecutive successes, never
+// exceeding Max.
+type EffectLimiter struct {
+	// The effect type name (e.g. move).
+	Name string `json:"Name"`
+
+	// The configured maximum concurrency.
+	Max int64 `json:"Max"`
+
+	// The current concurrency limit.
+	Limit int64 `json:"Limit"`
+
+	// The number of rate limit errors seen.
+	RateLimited int64 `json:"RateLimited"`
+
+	// The number of enactments in progress.
+	active int64
+
+	// Consecutive successes since the limit last changed.
+	successes int64
+
+	// Used to protect all members.
+	mux sync.Mutex
+
+	// Signalled when a slot is released or the limit changes.
+	cond *sync.Cond
+}
+
+// NewEffectLimiter returns a limiter allowing max concurrent enactments.
+func NewEffectLimiter(name string, max int64) *EffectLimiter {
+	l := &EffectLimiter{
+		Name:  name,
+		Max:   max,
+		Limit: max,
+	}
+	l.cond = sync.NewCond(&l.mux)
+	return l
+}
+
+// acquire starts an enactment, waiting while the effect is at its limit. Safe
+// to call on nil (no limit).
+func (l *EffectLimiter) acquire() {
+	if l == nil {
+		return
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	for l.active >= l.Limit {
+		l.cond.Wait()
+	}
+	l.active++
+}
+
+// release ends an enactment started with acquire, adjusting the limit by the
+// enactment's result err. Safe to call on nil (no limit).
+func (l *EffectLimiter) release(err error) {
+	if l == nil {
+		return
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	defer l.cond.Broadcast()
+	l.active--
+
+	if isRateLimited(err) {
+		l.RateLimited++
+		l.successes = 0
+		if l.Limit > 1 {
+			l.Limit /= 2
+		}
+	} else if err == nil && l.Limit < l.Max {
+		l.successes++
+		if l.successes >= l.Limit {
+			l.Limit++
+			l.successes = 0
+		}
+	}
+}
+
+// textResult returns a text representation of the limiter state.
+func (l *EffectLimiter) textResult() string {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return fmt.Sprintf("%v: limit %v of %v, rate limited %v times\n",
+		l.Name, l.Limit, l.Max, l.RateLimited)
+}
+
+// isRateLimited returns true if err is GCS telling us to slow down.
+func isRateLimited(err error) bool {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) {
+		return false
+	}
+	if gerr.Code == http.StatusTooManyRequests {
+		return true
+	}
+	for _, item := range gerr.Errors {
+		if item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" {
+			return true
+		}
+	}
+	return false
+}
+
+// effectName returns the name of the effect's type as used in configuration.
+func effectName(effect effects.Effect) string {
+	switch effect.(type) {
+	case *effects.NoopEffect:
+		return "noop"
+	case *effects.DuplicateEffect:
+		return "duplicate"
+	case *effects.MoveEffect:
+		return "move"
+	case *effects.ChillEffect:
+		return "chill"
+	case *effects.DeleteEffect:
+		return "delete"
+	case *effects.MetadataEffect:
+		return "metadata"
+	case *effects.ACLEffect:
+		return "acl"
+	case *effects.QuarantineEffect:
+		return "quarantine"
+	default:
+		return fmt.Sprintf("%T", effect)
+	}
+}
+
+// parseEffectJobs parses a comma separated list of effect=jobs pairs (e.g.
+// "move=50,chill=500") into limiters keyed by effect name.
+func parseEffectJobs(spec string) (map[string]*EffectLimiter, error) {
+	jobs := make(map[string]int64)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("effect jobs %q is not of the form effect=jobs", pair)
+		}
+		name := strings.TrimSpace(kv[0])
+		n, err := strconv.ParseInt(strings.TrimSpace(kv[1]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("effect jobs for %v must be a positive integer: %q", name, kv[1])
+		}
+		jobs[name] = n
+	}
+	return effectLimiters(jobs)
+}
+
+// effectLimiters returns limiters keyed by effect name for the jobs of each
+// effect.
+func effectLimiters(jobs map[string]int64) (map[string]*EffectLimiter, error) {
+	known := []string{"noop", "duplicate", "move", "chill", "delete", "metadata", "acl", "quarantine"}
+	limiters := make(map[string]*EffectLimiter)
+	for name, n := range jobs {
+		if !StringInSlice(name, known) {
+			return nil, fmt.Errorf("unknown effect %q, expected one of %v", name, known)
+		}
+		if n < 1 {
+			return nil, fmt.Errorf("effect jobs for %v must be a positive integer: %v", name, n)
+		}
+		limiters[name] = NewEffectLimiter(name, n)
+	}
+	return limiters, nil
+}
+
+// limitersTextResult returns the text representation of all limiters.
+func limitersTextResult(limiters map[string]*EffectLimiter) string {
+	names := make([]string, 0, len(limiters))
+	for name := range limiters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	s := ""
+	for _, name := range names {
+		s += limiters[name].textResult()
+	}
+	return s
+}
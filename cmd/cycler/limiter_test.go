@@ -0,0 +1,153 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestParseEffectJobs(t *testing.T) {
+	limiters, err := parseEffectJobs("move=50, chill=500")
+	if err != nil {
+		t.Fatalf("parseEffectJobs returned an err: %v", err)
+	}
+	if len(limiters) != 2 || limiters["move"].Max != 50 || limiters["chill"].Limit != 500 {
+		t.Errorf("unexpected limiters: %+v", limiters)
+	}
+
+	limiters, err = parseEffectJobs("")
+	if err != nil || len(limiters) != 0 {
+		t.Errorf("empty spec returned %v, %v", limiters, err)
+	}
+
+	for _, bad := range []string{"move", "teleport=1", "move=0", "move=x"} {
+		if _, err := parseEffectJobs(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestIsRateLimited(t *testing.T) {
+	tooMany := fmt.Errorf("wrapped: %w", &googleapi.Error{Code: http.StatusTooManyRequests})
+	if !isRateLimited(tooMany) {
+		t.Error("429 should be rate limited")
+	}
+	reason := &googleapi.Error{Code: http.StatusForbidden,
+		Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}
+	if !isRateLimited(reason) {
+		t.Error("userRateLimitExceeded should be rate limited")
+	}
+	if isRateLimited(&googleapi.Error{Code: http.StatusNotFound}) {
+		t.Error("404 should not be rate limited")
+	}
+	if isRateLimited(errors.New("plain")) || isRateLimited(nil) {
+		t.Error("non api errors should not be rate limited")
+	}
+}
+
+func TestEffectLimiterAdapts(t *testing.T) {
+	l := NewEffectLimiter("move", 8)
+	rateLimited := &googleapi.Error{Code: http.StatusTooManyRequests}
+
+	l.acquire()
+	l.release(rateLimited)
+	if l.Limit != 4 || l.RateLimited != 1 {
+		t.Errorf("expected limit 4 after a rate limit, got %v", l.Limit)
+	}
+
+	// Four consecutive successes grow the limit by one.
+	for i := 0; i < 4; i++ {
+		l.acquire()
+		l.release(nil)
+	}
+	if l.Limit != 5 {
+		t.Errorf("expected limit 5 after successes, got %v", l.Limit)
+	}
+
+	// The limit never drops below one.
+	for i := 0; i < 10; i++ {
+		l.acquire()
+		l.release(rateLimited)
+	}
+	if l.Limit != 1 {
+		t.Errorf("expected limit 1, got %v", l.Limit)
+	}
+}
+
+func TestEffectLimiterBoundsConcurrency(t *testing.T) {
+	l := NewEffectLimiter("chill", 3)
+	var active, maxActive int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.acquire()
+			n := atomic.AddInt64(&active, 1)
+			for {
+				m := atomic.LoadInt64(&maxActive)
+				if n <= m || atomic.CompareAndSwapInt64(&maxActive, m, n) {
+					break
+				}
+			}
+			atomic.AddInt64(&active, -1)
+			l.release(nil)
+		}()
+	}
+	wg.Wait()
+	if maxActive > 3 {
+		t.Errorf("%v enactments ran concurrently, limit is 3", maxActive)
+	}
+}
+
+func TestEffectLimiterWaits(t *testing.T) {
+	l := NewEffectLimiter("move", 2)
+	l.acquire()
+	l.acquire()
+
+	acquired := make(chan bool)
+	go func() {
+		l.acquire()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("a full limiter shouldn't start an enactment")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	l.release(nil)
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Error("a released slot should start the waiting enactment")
+	}
+}
+
+func TestEffectLimiterConfig(t *testing.T) {
+	limiters, err := effectLimiters(map[string]int64{"move": 50})
+	if err != nil || len(limiters) != 1 || limiters["move"].Max != 50 {
+		t.Errorf("unexpected limiters: %+v, %v", limiters, err)
+	}
+	for _, bad := range []map[string]int64{{"teleport": 1}, {"move": 0}} {
+		if _, err := effectLimiters(bad); err == nil {
+			t.Errorf("expected an error for %v", bad)
+		}
+	}
+}
+
+func TestEffectLimiterNil(t *testing.T) {
+	var l *EffectLimiter
+	l.acquire()
+	l.release(errors.New("anything"))
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"sort"
 	"time"
 
 	cycler_pb "go.chromium.org/chromiumos/infra/proto/go/cycler"
@@ -26,6 +27,9 @@ type Policy struct {
 	// The policy effect configuration (contains effect_configuration).
 	Config *cycler_pb.PolicyEffectConfiguration `json:"PolicyEffectConfiguration"`
 
+	// The extended effect configuration, used if Config sets no effect.
+	ExtendedConfig *ExtendedEffectConfiguration `json:"ExtendedEffectConfiguration,omitempty"`
+
 	// We must be explicitly allowed to mutate after policy determinations.
 	MutationAllowed bool `json:"MutationAllowed"`
 
@@ -36,9 +40,16 @@ type Policy struct {
 	// Make stats for all the objects we act on as well ('as' -> actionStats).
 	ActionStats *Stats `json:"ActionStats"`
 
+	// The same pair of stats per bucket, only kept when iterating more than
+	// one bucket. Not modified after init so needs no locking.
+	BucketStats map[string]*BucketStats `json:"BucketStats,omitempty"`
+
 	// The effect we've configured.
 	Effect effects.Effect `json:"Effect"` // effect.effectEffect(effect, effect, ...)    ;)
 
+	// Limits on the total cost of the run, checked before every action.
+	Guardrails *Guardrails `json:"Guardrails"`
+
 	// This run's uuid, passed by the initilizer.
 	RunUUID string `json:"RunUUID"`
 
@@ -48,6 +59,9 @@ type Policy struct {
 	// The prepared (via init()) query to run on the submitted objects.
 	q *rego.PreparedEvalQuery
 
+	// Bounds the concurrent enactments of the effect, nil if unlimited.
+	limiter *EffectLimiter
+
 	// The compiled regex to apply to each prefix.
 	prefixRegexp *regexp.Regexp
 
@@ -58,25 +72,43 @@ type Policy struct {
 	logSink chan []byte
 }
 
+// BucketStats are the stats of the objects of a single bucket.
+type BucketStats struct {
+	PrefixStats *Stats `json:"PrefixStats"`
+	ActionStats *Stats `json:"ActionStats"`
+}
+
 // PolicyResult is the closure of inputs and outputs for a policy, taken
 // together and usually printed or sent to a log.
 type PolicyResult struct {
 	InputObject map[string]interface{} `json:"InputObject"`
 	ResultSet   *rego.ResultSet        `json:"ResultSet"`
 	ActionTime  time.Time              `json:"ActionTime"`
+	Effect      string                 `json:"Effect"`
+
+	// The invocation that acted, and the bucket/name of the object the
+	// effect left (if any) for the audit trail.
+	InvocationID string `json:"InvocationID"`
+	AuditTarget  string `json:"AuditTarget,omitempty"`
 }
 
 // init takes a json document configuration and sets up the effect.
 func (ap *Policy) init(ctx context.Context, client *storage.Client,
 	logSink chan []byte, config *cycler_pb.PolicyEffectConfiguration,
+	extendedConfig *ExtendedEffectConfiguration,
 	statsConfig *cycler_pb.StatsConfiguration, cmdMutationAllowed bool,
-	runConfigMutationAllowed bool, runUUID string) {
+	runConfigMutationAllowed bool, runUUID string, guardrails *Guardrails,
+	buckets []string, limiters map[string]*EffectLimiter) {
 
 	// Set the UUID.
 	ap.RunUUID = runUUID
 
+	// Set the guardrails.
+	ap.Guardrails = guardrails
+
 	// Set the config.
 	ap.Config = config
+	ap.ExtendedConfig = extendedConfig
 
 	// Set the GCP client.
 	ap.client = client
@@ -95,6 +127,20 @@ func (ap *Policy) init(ctx context.Context, client *storage.Client,
 	ap.ActionStats = &Stats{}
 	ap.ActionStats.init(ctx, statsConfig)
 
+	// Break the stats down by bucket if there is more than one.
+	if len(buckets) > 1 {
+		ap.BucketStats = make(map[string]*BucketStats)
+		for _, bucket := range buckets {
+			bs := &BucketStats{
+				PrefixStats: &Stats{},
+				ActionStats: &Stats{},
+			}
+			bs.PrefixStats.init(ctx, statsConfig)
+			bs.ActionStats.init(ctx, statsConfig)
+			ap.BucketStats[bucket] = bs
+		}
+	}
+
 	var protoConfig interface{}
 	switch effectType := ap.Config.EffectConfiguration.(type) {
 	case *cycler_pb.PolicyEffectConfiguration_Noop:
@@ -116,15 +162,34 @@ func (ap *Policy) init(ctx context.Context, client *storage.Client,
 	// ...
 
 	case nil:
-		glog.Errorf("Effect configuration type not set: %v", effectType)
-		os.Exit(2)
+		if ap.ExtendedConfig == nil {
+			glog.Errorf("Effect configuration type not set: %v", effectType)
+			os.Exit(2)
+		}
+		var err error
+		if ap.Effect, protoConfig, err = ap.ExtendedConfig.effect(); err != nil {
+			glog.Errorf("%v", err)
+			os.Exit(2)
+		}
 	default:
 		glog.Errorf("Effect configuration type not implemented: %v", effectType)
 		os.Exit(2)
 	}
 
+	if ap.Config.EffectConfiguration != nil && ap.ExtendedConfig != nil {
+		glog.Errorf("Effect configured in both the policy effect configuration " +
+			"and the extended effect configuration")
+		os.Exit(2)
+	}
+
 	actor := ap.Effect.DefaultActor()
 	ap.Effect.Initialize(protoConfig, actor, runConfigMutationAllowed, cmdMutationAllowed)
+	if audited, ok := ap.Effect.(effects.Audited); ok && auditStamp {
+		audited.SetAuditStamp(ap.RunUUID)
+	}
+
+	// Effects of the same type share a limiter across policies.
+	ap.limiter = limiters[effectName(ap.Effect)]
 
 	// Parse the rego expression defined.
 	ap.r = rego.New(
@@ -150,9 +215,18 @@ func (ap *Policy) submitUnit(ctx context.Context, unit *AttrUnit) error {
 
 	glog.V(3).Infof("submited work unit: %+v\n", attr)
 
-	// Call the bucket stats module on each object...
-	if err := ap.PrefixStats.submitUnit(ctx, attr); err != nil {
-		return fmt.Errorf("error in submitUnit: %v", err)
+	// Call the bucket stats module on each object, once however often the
+	// unit comes back.
+	if !unit.statsSubmitted {
+		if err := ap.PrefixStats.submitUnit(ctx, attr); err != nil {
+			return fmt.Errorf("error in submitUnit: %v", err)
+		}
+		if bs, ok := ap.BucketStats[attr.Bucket]; ok {
+			if err := bs.PrefixStats.submitUnit(ctx, attr); err != nil {
+				return fmt.Errorf("error in submitUnit: %v", err)
+			}
+		}
+		unit.statsSubmitted = true
 	}
 
 	ageDays, err := AgeInDays(attr.Created)
@@ -184,19 +258,38 @@ func (ap *Policy) submitUnit(ctx context.Context, unit *AttrUnit) error {
 	}
 
 	if act {
+		// Wait for a slot of the effect, then reserve the cost of the action
+		// before doing anything irreversible. Admitting after the wait means
+		// an action whose guardrails tripped meanwhile isn't enacted.
+		ap.limiter.acquire()
+		cost := costOf(ap.Effect, attr)
+		if err := ap.Guardrails.admit(cost); err != nil {
+			ap.limiter.release(err)
+			return err
+		}
+
 		// Do some effect here (e.g. move the object, archive it, delete it...).
 		res, err := ap.Effect.Enact(ctx, ap.client, attr)
+		ap.limiter.release(err)
 
 		if err != nil {
-			return fmt.Errorf("error in Effect.Enact: %v", err)
+			ap.Guardrails.release(cost)
+			return fmt.Errorf("error in Effect.Enact: %w", err)
 		} else if res.HasActed() {
 			glog.V(3).Infof("acted on: %+v\n%+v", rs, res)
 
 			// This is the set of information serialized to the log.
 			pres := PolicyResult{
-				InputObject: annoAttr,
-				ResultSet:   &rs,
-				ActionTime:  time.Now(),
+				InputObject:  annoAttr,
+				ResultSet:    &rs,
+				ActionTime:   time.Now(),
+				Effect:       effectName(ap.Effect),
+				InvocationID: ap.RunUUID,
+			}
+			if audited, ok := res.(effects.AuditedResult); ok {
+				if bucket, name, ok := audited.AuditTarget(); ok {
+					pres.AuditTarget = bucket + "/" + name
+				}
 			}
 			jpres, err := json.Marshal(pres)
 			if err != nil {
@@ -209,8 +302,18 @@ func (ap *Policy) submitUnit(ctx context.Context, unit *AttrUnit) error {
 			if err != nil {
 				return fmt.Errorf("error in submitUnit: %v", err)
 			}
+			if bs, ok := ap.BucketStats[attr.Bucket]; ok {
+				if err := bs.ActionStats.submitUnit(ctx, attr); err != nil {
+					return fmt.Errorf("error in submitUnit: %v", err)
+				}
+			}
+		} else if skipped, ok := res.(effects.SkippedResult); ok && skipped.Skipped() {
+			// The effect had nothing to do (e.g. the object is up to date).
+			glog.V(3).Infof("matched but skipped: %+v", attr.Name)
+			ap.Guardrails.release(cost)
 		} else {
-			return fmt.Errorf("matched but did not act on: %+v", err)
+			ap.Guardrails.release(cost)
+			return fmt.Errorf("matched but did not act on: %+v", attr.Name)
 		}
 	} else {
 		glog.V(3).Infof("did not act on: %+v\n%+v", rs, err)
@@ -260,5 +363,17 @@ func (ap *Policy) textResult() string {
 	s += ap.PrefixStats.textResult()
 	s += "\nActed Objects Stats:\n"
 	s += ap.ActionStats.textResult()
+
+	buckets := make([]string, 0, len(ap.BucketStats))
+	for bucket := range ap.BucketStats {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+	for _, bucket := range buckets {
+		s += fmt.Sprintf("\nBucket gs://%v All Objects Iterated Stats:\n", bucket)
+		s += ap.BucketStats[bucket].PrefixStats.textResult()
+		s += fmt.Sprintf("\nBucket gs://%v Acted Objects Stats:\n", bucket)
+		s += ap.BucketStats[bucket].ActionStats.textResult()
+	}
 	return s
 }
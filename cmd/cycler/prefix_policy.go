@@ -0,0 +1,273 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.chromium.org/chromiumos/infra/go/cmd/cycler/effects"
+	cycler_pb "go.chromium.org/chromiumos/infra/proto/go/cycler"
+
+	"cloud.google.com/go/storage"
+	"github.com/golang/protobuf/jsonpb"
+)
+
+// PrefixPolicyConfig is a single entry of the prefix policy configuration
+// file. The policy effect configuration is in the same jsonpb form used for
+// the policy_effect_configuration of the RunConfig, the optional extended
+// effect configuration is in the form of --extendedEffectConfigPath.
+type PrefixPolicyConfig struct {
+	Prefix                      string          `json:"prefix"`
+	PolicyEffectConfiguration   json.RawMessage `json:"policy_effect_configuration"`
+	ExtendedEffectConfiguration json.RawMessage `json:"extended_effect_configuration"`
+}
+
+// PrefixPolicyConfigs is the top level of the prefix policy configuration file.
+// The RunConfig proto has no field for the effect concurrency, so the limits
+// of all policies are set here (or with --effectJobs).
+type PrefixPolicyConfigs struct {
+	PrefixPolicies []PrefixPolicyConfig `json:"prefix_policies"`
+	EffectJobs     map[string]int64     `json:"effect_jobs"`
+}
+
+// PrefixPolicies routes each object to the Policy configured for the longest
+// prefix of its name, objects matching no prefix go to the Default policy
+// (the one configured in the RunConfig).
+type PrefixPolicies struct {
+	// The policy from the RunConfig.
+	Default *Policy
+
+	// The policies from the prefix policy configuration keyed by prefix.
+	ByPrefix map[string]*Policy
+
+	// The effect concurrency limiters shared by all policies.
+	EffectLimiters map[string]*EffectLimiter
+
+	// The keys of ByPrefix, longest first.
+	prefixes []string
+}
+
+// loadPrefixPolicyConfigs reads the prefix policy configuration file at path
+// and returns the parsed policy effect configurations keyed by prefix, and
+// the extended effect configurations of the prefixes that have one.
+func loadPrefixPolicyConfigs(path string) (map[string]*cycler_pb.PolicyEffectConfiguration,
+	map[string]*ExtendedEffectConfiguration, error) {
+
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't read prefix policy config: %v", err)
+	}
+
+	var configs PrefixPolicyConfigs
+	if err := json.Unmarshal(in, &configs); err != nil {
+		return nil, nil, fmt.Errorf("prefix policy config couldn't be unmarshaled: %v", err)
+	}
+
+	result := make(map[string]*cycler_pb.PolicyEffectConfiguration)
+	extended := make(map[string]*ExtendedEffectConfiguration)
+	for _, ppc := range configs.PrefixPolicies {
+		if ppc.Prefix == "" {
+			return nil, nil, fmt.Errorf("prefix policy has an empty prefix, " +
+				"use the RunConfig policy_effect_configuration instead")
+		}
+		if _, ok := result[ppc.Prefix]; ok {
+			return nil, nil, fmt.Errorf("prefix policy %v is defined more than once", ppc.Prefix)
+		}
+		config := &cycler_pb.PolicyEffectConfiguration{}
+		if err := jsonpb.Unmarshal(bytes.NewReader(ppc.PolicyEffectConfiguration), config); err != nil {
+			return nil, nil, fmt.Errorf("prefix policy %v couldn't be unmarshaled: %v", ppc.Prefix, err)
+		}
+		// Iteration is filtered before objects are routed to a policy.
+		if config.PrefixRegexp != "" {
+			return nil, nil, fmt.Errorf("prefix policy %v sets prefix_regexp, only the RunConfig "+
+				"policy_effect_configuration's is used", ppc.Prefix)
+		}
+		result[ppc.Prefix] = config
+		if len(ppc.ExtendedEffectConfiguration) > 0 {
+			if extended[ppc.Prefix], err = parseExtendedEffectConfig(ppc.ExtendedEffectConfiguration); err != nil {
+				return nil, nil, fmt.Errorf("prefix policy %v: %v", ppc.Prefix, err)
+			}
+		}
+	}
+	return result, extended, nil
+}
+
+// loadEffectJobs reads the effect concurrency limits of the prefix policy
+// configuration file at path, keyed by effect name.
+func loadEffectJobs(path string) (map[string]int64, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read prefix policy config: %v", err)
+	}
+
+	var configs PrefixPolicyConfigs
+	if err := json.Unmarshal(in, &configs); err != nil {
+		return nil, fmt.Errorf("prefix policy config couldn't be unmarshaled: %v", err)
+	}
+	return configs.EffectJobs, nil
+}
+
+// init sets up the default policy and one policy per configured prefix. All
+// policies share the stats configuration, mutation checks and guardrails.
+func (pp *PrefixPolicies) init(ctx context.Context, client *storage.Client,
+	logSink chan []byte, config *cycler_pb.PolicyEffectConfiguration,
+	extendedConfig *ExtendedEffectConfiguration,
+	prefixConfigs map[string]*cycler_pb.PolicyEffectConfiguration,
+	prefixExtendedConfigs map[string]*ExtendedEffectConfiguration,
+	statsConfig *cycler_pb.StatsConfiguration, cmdMutationAllowed bool,
+	runConfigMutationAllowed bool, runUUID string, guardrails *Guardrails,
+	buckets []string, limiters map[string]*EffectLimiter) {
+
+	pp.EffectLimiters = limiters
+	pp.Default = &Policy{}
+	pp.Default.init(ctx, client, logSink, config, extendedConfig, statsConfig, cmdMutationAllowed,
+		runConfigMutationAllowed, runUUID, guardrails, buckets, limiters)
+
+	pp.ByPrefix = make(map[string]*Policy)
+	pp.prefixes = make([]string, 0, len(prefixConfigs))
+	for prefix, prefixConfig := range prefixConfigs {
+		pol := &Policy{}
+		pol.init(ctx, client, logSink, prefixConfig, prefixExtendedConfigs[prefix], statsConfig, cmdMutationAllowed,
+			runConfigMutationAllowed, runUUID, guardrails, buckets, limiters)
+		pp.ByPrefix[prefix] = pol
+		pp.prefixes = append(pp.prefixes, prefix)
+	}
+	sortLongestFirst(pp.prefixes)
+}
+
+// checkQuarantineBuckets returns an error if a quarantine effect would
+// quarantine into one of the iterated buckets without a prefix, quarantined
+// objects couldn't be told apart from the objects of the bucket.
+func (pp *PrefixPolicies) checkQuarantineBuckets(buckets []string) error {
+	for _, pol := range append([]*Policy{pp.Default}, pp.policies()...) {
+		qe, ok := pol.Effect.(*effects.QuarantineEffect)
+		if ok && qe.Config.QuarantinePrefix == "" && StringInSlice(qe.Config.QuarantineBucket, buckets) {
+			return fmt.Errorf("quarantine bucket %v is iterated, it requires a quarantine_prefix",
+				qe.Config.QuarantineBucket)
+		}
+	}
+	return nil
+}
+
+// sortLongestFirst orders prefixes so the first match found is the longest.
+func sortLongestFirst(prefixes []string) {
+	sort.Slice(prefixes, func(i, j int) bool {
+		if len(prefixes[i]) != len(prefixes[j]) {
+			return len(prefixes[i]) > len(prefixes[j])
+		}
+		return prefixes[i] < prefixes[j]
+	})
+}
+
+// longestPrefixMatch returns the first of prefixes that name starts with, or
+// the empty string. prefixes must be sorted by sortLongestFirst.
+func longestPrefixMatch(name string, prefixes []string) string {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
+
+// policyFor returns the policy that applies to the object name.
+func (pp *PrefixPolicies) policyFor(name string) *Policy {
+	if prefix := longestPrefixMatch(name, pp.prefixes); prefix != "" {
+		return pp.ByPrefix[prefix]
+	}
+	return pp.Default
+}
+
+func (pp *PrefixPolicies) submitUnit(ctx context.Context, unit *AttrUnit) error {
+	return pp.policyFor(unit.Attrs.Name).submitUnit(ctx, unit)
+}
+
+// PrefixRegexp is the iteration prefix regexp, only the default policy's
+// prefix_regexp is used as it is applied before any object is routed.
+func (pp *PrefixPolicies) PrefixRegexp() *regexp.Regexp {
+	// Inventory runs don't initialize the policies and list every prefix.
+	if pp.Default == nil {
+		return nil
+	}
+	return pp.Default.PrefixRegexp()
+}
+
+func (pp *PrefixPolicies) close() error {
+	pp.Default.close()
+	for _, pol := range pp.ByPrefix {
+		pol.close()
+	}
+	return nil
+}
+
+// jsonResult keeps the default policy's fields at the top level so that the
+// output is unchanged when no prefix policies are configured.
+func (pp *PrefixPolicies) jsonResult() ([]byte, error) {
+	return json.Marshal(struct {
+		*Policy
+		PrefixPolicies map[string]*Policy        `json:"PrefixPolicies,omitempty"`
+		EffectLimiters map[string]*EffectLimiter `json:"EffectLimiters,omitempty"`
+		ErrorStats     *ErrorStats               `json:"ErrorStats"`
+	}{pp.Default, pp.ByPrefix, pp.EffectLimiters, errorStats})
+}
+
+func (pp *PrefixPolicies) textResult() string {
+	s := pp.Default.textResult()
+	for _, prefix := range pp.sortedPrefixes() {
+		s += fmt.Sprintf("\nPrefix policy %v:\n", prefix)
+		s += pp.ByPrefix[prefix].textResult()
+	}
+	if len(pp.ByPrefix) > 0 {
+		s += "\nAll policies:\n"
+		s += pp.totalsTextResult()
+	}
+	s += "\nGuardrails:\n"
+	s += pp.Default.Guardrails.textResult()
+	if len(pp.EffectLimiters) > 0 {
+		s += "\nEffect concurrency:\n"
+		s += limitersTextResult(pp.EffectLimiters)
+	}
+	s += "\nErrors by class:\n"
+	s += errorStats.textResult()
+	return s
+}
+
+// totalsTextResult sums the objects iterated and acted on over every policy,
+// the default policy's stats only count the objects no prefix matched.
+func (pp *PrefixPolicies) totalsTextResult() string {
+	var iterated, iteratedBytes, acted, actedBytes int64
+	for _, pol := range append([]*Policy{pp.Default}, pp.policies()...) {
+		iterated += pol.PrefixStats.SizeBytesHistogram.Count
+		iteratedBytes += pol.PrefixStats.RootSizeBytes
+		acted += pol.ActionStats.SizeBytesHistogram.Count
+		actedBytes += pol.ActionStats.RootSizeBytes
+	}
+	s := fmt.Sprintf("Objects iterated: %v (%v)\n", iterated, ByteCountSI(iteratedBytes))
+	s += fmt.Sprintf("Objects acted on: %v (%v)\n", acted, ByteCountSI(actedBytes))
+	return s
+}
+
+// policies returns the prefix policies in the order of sortedPrefixes.
+func (pp *PrefixPolicies) policies() []*Policy {
+	policies := make([]*Policy, 0, len(pp.ByPrefix))
+	for _, prefix := range pp.sortedPrefixes() {
+		policies = append(policies, pp.ByPrefix[prefix])
+	}
+	return policies
+}
+
+// sortedPrefixes returns the configured prefixes in lexical order for display.
+func (pp *PrefixPolicies) sortedPrefixes() []string {
+	prefixes := append([]string{}, pp.prefixes...)
+	sort.Strings(prefixes)
+	return prefixes
+}
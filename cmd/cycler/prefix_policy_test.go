@@ -0,0 +1,189 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.chromium.org/chromiumos/infra/go/cmd/cycler/effects"
+
+	"cloud.google.com/go/storage"
+)
+
+func TestLongestPrefixMatch(t *testing.T) {
+	prefixes := []string{"logs/", "images/", "logs/keep/"}
+	sortLongestFirst(prefixes)
+
+	cases := map[string]string{
+		"logs/a.txt":        "logs/",
+		"logs/keep/a.txt":   "logs/keep/",
+		"images/a.bin":      "images/",
+		"other/a.txt":       "",
+		"logs":              "",
+		"logs/keep/x/y.txt": "logs/keep/",
+	}
+	for name, expected := range cases {
+		if actual := longestPrefixMatch(name, prefixes); actual != expected {
+			t.Errorf("longestPrefixMatch(%v) = %v, expected %v", name, actual, expected)
+		}
+	}
+}
+
+func TestLoadPrefixPolicyConfigs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prefix_policy_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "prefix_policies.json")
+	config := `{
+  "prefix_policies": [
+    {
+      "prefix": "logs/",
+      "policy_effect_configuration": {
+        "delete": {},
+        "policy_document_path": "logs.rego"
+      }
+    },
+    {
+      "prefix": "images/",
+      "policy_effect_configuration": {
+        "chill": {"to_storage_class": "COLDLINE"},
+        "policy_document_path": "images.rego"
+      }
+    }
+  ],
+  "effect_jobs": {"chill": 500}
+}`
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("couldn't write config: %v", err)
+	}
+
+	configs, _, err := loadPrefixPolicyConfigs(path)
+	if err != nil {
+		t.Fatalf("loadPrefixPolicyConfigs returned an err: %v", err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("expected 2 configs, got %v", len(configs))
+	}
+	if configs["logs/"].GetDelete() == nil || configs["logs/"].PolicyDocumentPath != "logs.rego" {
+		t.Errorf("logs/ config not as expected: %+v", configs["logs/"])
+	}
+	if configs["images/"].GetChill() == nil {
+		t.Errorf("images/ config not as expected: %+v", configs["images/"])
+	}
+
+	jobs, err := loadEffectJobs(path)
+	if err != nil || len(jobs) != 1 || jobs["chill"] != 500 {
+		t.Errorf("effect jobs not as expected: %+v, %v", jobs, err)
+	}
+}
+
+func TestLoadPrefixPolicyConfigsDuplicate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prefix_policy_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "prefix_policies.json")
+	config := `{"prefix_policies": [
+    {"prefix": "logs/", "policy_effect_configuration": {"noop": {}}},
+    {"prefix": "logs/", "policy_effect_configuration": {"noop": {}}}
+  ]}`
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("couldn't write config: %v", err)
+	}
+
+	if _, _, err := loadPrefixPolicyConfigs(path); err == nil {
+		t.Error("expected an error for a duplicated prefix")
+	}
+}
+
+func TestLoadPrefixPolicyConfigsPrefixRegexp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prefix_policy_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "prefix_policies.json")
+	config := `{"prefix_policies": [
+    {"prefix": "logs/", "policy_effect_configuration": {"noop": {}, "prefix_regexp": "^logs/a"}}
+  ]}`
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("couldn't write config: %v", err)
+	}
+
+	if _, _, err := loadPrefixPolicyConfigs(path); err == nil {
+		t.Error("expected an error for a prefix policy with a prefix_regexp")
+	}
+}
+
+func TestPrefixPoliciesTotals(t *testing.T) {
+	ctx := context.Background()
+	newPolicy := func() *Policy {
+		pol := &Policy{PrefixStats: &Stats{}, ActionStats: &Stats{}}
+		pol.PrefixStats.init(ctx, nil)
+		pol.ActionStats.init(ctx, nil)
+		return pol
+	}
+	pp := PrefixPolicies{
+		Default:  newPolicy(),
+		ByPrefix: map[string]*Policy{"logs/": newPolicy()},
+		prefixes: []string{"logs/"},
+	}
+	submit := func(s *Stats, name string, size int64) {
+		if err := s.submitUnit(ctx, &storage.ObjectAttrs{Name: name, Size: size, Created: time.Now()}); err != nil {
+			t.Fatalf("submitUnit returned an err: %v", err)
+		}
+	}
+	submit(pp.Default.PrefixStats, "a.txt", 1000)
+	submit(pp.ByPrefix["logs/"].PrefixStats, "logs/a.txt", 2000)
+	submit(pp.ByPrefix["logs/"].ActionStats, "logs/a.txt", 2000)
+
+	expected := "Objects iterated: 2 (3.0 kB)\nObjects acted on: 1 (2.0 kB)\n"
+	if actual := pp.totalsTextResult(); actual != expected {
+		t.Errorf("totals are %q, expected %q", actual, expected)
+	}
+}
+
+func TestCheckQuarantineBuckets(t *testing.T) {
+	quarantine := func(prefix string) *Policy {
+		return &Policy{Effect: &effects.QuarantineEffect{Config: &effects.QuarantineEffectConfiguration{
+			QuarantineBucket: "quarantine",
+			QuarantinePrefix: prefix,
+		}}}
+	}
+	pp := PrefixPolicies{
+		Default:  &Policy{Effect: &effects.NoopEffect{}},
+		ByPrefix: map[string]*Policy{"logs/": quarantine("")},
+		prefixes: []string{"logs/"},
+	}
+	if err := pp.checkQuarantineBuckets([]string{"source"}); err != nil {
+		t.Errorf("a quarantine bucket that isn't iterated returned an err: %v", err)
+	}
+	if err := pp.checkQuarantineBuckets([]string{"source", "quarantine"}); err == nil {
+		t.Error("expected an error for an iterated quarantine bucket without a prefix")
+	}
+	pp.ByPrefix["logs/"] = quarantine("q/")
+	if err := pp.checkQuarantineBuckets([]string{"source", "quarantine"}); err != nil {
+		t.Errorf("an iterated quarantine bucket with a prefix returned an err: %v", err)
+	}
+}
+
+func TestPrefixRegexpUninitialized(t *testing.T) {
+	// Inventory runs iterate without initializing the policies.
+	pp := PrefixPolicies{}
+	if re := pp.PrefixRegexp(); re != nil {
+		t.Errorf("expected no prefix regexp, got %v", re)
+	}
+}
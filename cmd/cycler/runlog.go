@@ -5,12 +5,17 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,6 +24,7 @@ import (
 	"cloud.google.com/go/storage"
 	"github.com/golang/glog"
 	"golang.org/x/sync/semaphore"
+	"google.golang.org/api/iterator"
 )
 
 var newline = fmt.Sprintf("\n")
@@ -35,7 +41,9 @@ var newline = fmt.Sprintf("\n")
 //
 // Logs will pre appended with a timestamp and the uniq id of the cycler run.
 //
-// It currently allows both gs:// URLs as well as local file:// urls.
+// It currently allows both gs:// URLs as well as local file:// urls. If a
+// CloudLog is given every log is also forwarded to it, in which case the
+// destination URL may be left empty to only log to Cloud Logging.
 type Runlog struct {
 
 	// LogSink is the channel where producers can push their logs.
@@ -64,10 +72,14 @@ type Runlog struct {
 
 	// logShippers counts the number of routines currently engaged in shipping logs.
 	logShippers *semaphore.Weighted
+
+	// cloudLog receives a copy of every log if set.
+	cloudLog *CloudLog
 }
 
 // Init sets up the runlog, with json config bytes or nil if defaults should be used.
-func (rl *Runlog) Init(config *cycler_pb.RunLogConfiguration, client *storage.Client, wg *sync.WaitGroup) {
+func (rl *Runlog) Init(config *cycler_pb.RunLogConfiguration, client *storage.Client,
+	cloudLog *CloudLog, wg *sync.WaitGroup) {
 	ctx := context.Background()
 
 	// Initialize channels, waitgroups and semaphores.
@@ -78,6 +90,15 @@ func (rl *Runlog) Init(config *cycler_pb.RunLogConfiguration, client *storage.Cl
 	rl.client = client
 	rl.wg = wg
 	rl.logShippers = semaphore.NewWeighted(rl.Config.MaxUnpersistedLogs)
+	rl.cloudLog = cloudLog
+
+	// Logging only to Cloud Logging, there is no destination to validate.
+	if rl.Config.DestinationUrl == "" && rl.cloudLog != nil {
+		glog.V(0).Infof("No runlog destination, logging to cloud logging only.")
+		rl.wg.Add(1)
+		go rl.loggingCoordinator()
+		return
+	}
 
 	// Parse / Validate the destination URL.
 	dstURL, err := url.Parse(rl.Config.DestinationUrl)
@@ -154,6 +175,10 @@ func (rl *Runlog) loggingCoordinator() {
 
 		// New log incoming.
 		case log := <-rl.LogSink:
+			rl.cloudLog.Log(severityInfo, log)
+			if rl.dstURL == nil {
+				continue
+			}
 			incomingSize := int64(len(log))
 			if rl.logBufferSize+incomingSize >= rl.Config.ChunkSizeBytes {
 				rl.flush()
@@ -166,6 +191,10 @@ func (rl *Runlog) loggingCoordinator() {
 			// Put all outstanding logs on rl.LogSink (expand to fit).
 			for i := 0; i < len(rl.LogSink); i++ {
 				incomingLog := <-rl.LogSink
+				rl.cloudLog.Log(severityInfo, incomingLog)
+				if rl.dstURL == nil {
+					continue
+				}
 				rl.logBufferSize += int64(len(incomingLog))
 				rl.logBuffer = append(rl.logBuffer, incomingLog)
 			}
@@ -298,3 +327,88 @@ func (rl Runlog) createLogName() string {
 	timePart := time.Now().UTC().Format(time.RFC3339Nano)
 	return fmt.Sprintf("%v/%v.jsonl.gz", cyclerInvocationID, timePart)
 }
+
+// scanRunlog calls fn with every record of the runlog at p, either a gs:// url
+// or a local file:// url or path, searched recursively for .jsonl.gz files.
+// name is the file the record is read from.
+func scanRunlog(ctx context.Context, client *storage.Client, p string,
+	fn func(name string, record []byte) error) error {
+
+	read := func(name string, r io.Reader) error {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("runlog %v isn't gzipped: %v", name, err)
+		}
+		defer zr.Close()
+		scanner := bufio.NewScanner(zr)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			if err := fn(name, scanner.Bytes()); err != nil {
+				return err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("couldn't read runlog %v: %v", name, err)
+		}
+		return nil
+	}
+
+	if strings.HasPrefix(p, "gs://") {
+		return readGSRunlog(ctx, client, p, read)
+	}
+	// The form the runlog destination is configured in.
+	if strings.HasPrefix(p, "file://") {
+		u, err := url.Parse(p)
+		if err != nil {
+			return fmt.Errorf("runlog url %v couldn't be parsed: %v", p, err)
+		}
+		p = u.Path
+	}
+	return filepath.Walk(p, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("couldn't read runlog: %v", err)
+		}
+		if info.IsDir() || !strings.HasSuffix(name, ".jsonl.gz") {
+			return nil
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("couldn't read runlog: %v", err)
+		}
+		defer f.Close()
+		return read(name, f)
+	})
+}
+
+// readGSRunlog calls read on every .jsonl.gz object under the gs:// url p.
+func readGSRunlog(ctx context.Context, client *storage.Client, p string,
+	read func(name string, r io.Reader) error) error {
+
+	u, err := url.Parse(p)
+	if err != nil {
+		return fmt.Errorf("bad runlog url %v: %v", p, err)
+	}
+	bkt := client.Bucket(u.Host)
+	it := bkt.Objects(ctx, &storage.Query{Prefix: strings.TrimPrefix(u.Path, "/")})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't list runlog %v: %v", p, err)
+		}
+		if !strings.HasSuffix(attrs.Name, ".jsonl.gz") {
+			continue
+		}
+		r, err := bkt.Object(attrs.Name).NewReader(ctx)
+		if err != nil {
+			return fmt.Errorf("couldn't read runlog: %v", err)
+		}
+		err = read("gs://"+u.Host+"/"+attrs.Name, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package lint validates the testingconfig protos before they are uploaded.
+package lint
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"go.chromium.org/chromiumos/infra/proto/go/chromiumos"
+	"go.chromium.org/chromiumos/infra/proto/go/testplans"
+)
+
+// Problem is a single finding, Field locates it within its config.
+type Problem struct {
+	Config  string `json:"Config"`
+	Field   string `json:"Field"`
+	Message string `json:"Message"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%v: %v: %v", p.Config, p.Field, p.Message)
+}
+
+// Config names used in problems.
+const (
+	sourceTreeConfig = "SourceTreeTestCfg"
+	targetConfig     = "TargetTestRequirementsCfg"
+)
+
+// Lint returns the problems found in the configs. builderConfigs may be nil,
+// in which case builder names and build targets are not checked.
+func Lint(sourceCfg *testplans.SourceTreeTestCfg, targetCfg *testplans.TargetTestRequirementsCfg,
+	builderConfigs *chromiumos.BuilderConfigs) []Problem {
+
+	problems := make([]Problem, 0)
+	groups := suiteGroups(targetCfg)
+
+	for i, rule := range sourceCfg.GetSourceTestRules() {
+		field := fmt.Sprintf("source_test_rules[%v]", i)
+		problems = append(problems, lintFilePattern(field+".file_pattern", rule.GetFilePattern())...)
+
+		if (rule.GetSubtractiveRule() == nil) == (rule.GetAdditiveRule() == nil) {
+			problems = append(problems, Problem{sourceTreeConfig, field,
+				"exactly one of subtractive_rule and additive_rule must be set"})
+		}
+		if sr := rule.GetSubtractiveRule(); sr != nil {
+			problems = append(problems, lintTestGroups(field+".subtractive_rule.only_keep_all_suites_in_groups",
+				sr.GetOnlyKeepAllSuitesInGroups(), groups)...)
+			problems = append(problems, lintTestGroups(field+".subtractive_rule.only_keep_one_suite_from_each_group",
+				sr.GetOnlyKeepOneSuiteFromEachGroup(), groups)...)
+		}
+		if ar := rule.GetAdditiveRule(); ar != nil {
+			problems = append(problems, lintTestGroups(field+".additive_rule.add_all_suites_in_groups",
+				ar.GetAddAllSuitesInGroups(), groups)...)
+			problems = append(problems, lintTestGroups(field+".additive_rule.add_one_suite_from_each_group",
+				ar.GetAddOneSuiteFromEachGroup(), groups)...)
+		}
+	}
+
+	if builderConfigs != nil {
+		problems = append(problems, lintTargets(targetCfg, builderConfigs)...)
+	}
+	return problems
+}
+
+// lintFilePattern checks that the pattern and exclude patterns are set and
+// well formed bash globstar patterns.
+func lintFilePattern(field string, fp *testplans.FilePattern) []Problem {
+	if fp.GetPattern() == "" {
+		return []Problem{{sourceTreeConfig, field + ".pattern", "pattern is empty"}}
+	}
+	problems := make([]Problem, 0)
+	if err := checkPattern(fp.GetPattern()); err != nil {
+		problems = append(problems, Problem{sourceTreeConfig, field + ".pattern", err.Error()})
+	}
+	for i, exclude := range fp.GetExcludePatterns() {
+		if err := checkPattern(exclude); err != nil {
+			problems = append(problems, Problem{sourceTreeConfig,
+				fmt.Sprintf("%v.exclude_patterns[%v]", field, i), err.Error()})
+		}
+	}
+	return problems
+}
+
+// checkPattern returns an error if pattern isn't a valid globstar pattern.
+// Every path element other than ** must be a valid path.Match pattern.
+func checkPattern(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("pattern is empty")
+	}
+	for _, elem := range strings.Split(pattern, "/") {
+		if elem == "**" {
+			continue
+		}
+		if _, err := path.Match(elem, ""); err != nil {
+			return fmt.Errorf("pattern %q doesn't compile: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// lintTestGroups checks that a restriction names at least one group and that
+// every group named has suites in the target test requirements.
+func lintTestGroups(field string, tg *testplans.TestGroups, groups map[string]int) []Problem {
+	if tg == nil {
+		return nil
+	}
+	if len(tg.GetName()) == 0 {
+		return []Problem{{sourceTreeConfig, field, "no test groups are named"}}
+	}
+	problems := make([]Problem, 0)
+	for _, name := range tg.GetName() {
+		if groups[name] == 0 {
+			problems = append(problems, Problem{sourceTreeConfig, field,
+				fmt.Sprintf("test group %q has no suites in the %v", name, targetConfig)})
+		}
+	}
+	return problems
+}
+
+// suiteGroups returns the number of suites in each test suite group.
+func suiteGroups(targetCfg *testplans.TargetTestRequirementsCfg) map[string]int {
+	groups := make(map[string]int)
+	add := func(common *testplans.TestSuiteCommon) {
+		for _, g := range common.GetTestSuiteGroups() {
+			groups[g.GetTestSuiteGroup()]++
+		}
+	}
+	for _, req := range targetCfg.GetPerTargetTestRequirements() {
+		for _, t := range req.GetHwTestCfg().GetHwTest() {
+			add(t.GetCommon())
+		}
+		for _, t := range req.GetVmTestCfg().GetVmTest() {
+			add(t.GetCommon())
+		}
+		for _, t := range req.GetDirectTastVmTestCfg().GetTastVmTest() {
+			add(t.GetCommon())
+		}
+	}
+	return groups
+}
+
+// lintTargets checks that the builder and build target of every target
+// criteria exist. Builder configs don't name their build target, a build
+// target exists if a builder is named after it (e.g. eve-cq for eve).
+func lintTargets(targetCfg *testplans.TargetTestRequirementsCfg,
+	builderConfigs *chromiumos.BuilderConfigs) []Problem {
+
+	builders := make(map[string]bool)
+	for _, bc := range builderConfigs.GetBuilderConfigs() {
+		builders[bc.GetId().GetName()] = true
+	}
+
+	problems := make([]Problem, 0)
+	for i, req := range targetCfg.GetPerTargetTestRequirements() {
+		field := fmt.Sprintf("per_target_test_requirements[%v].target_criteria", i)
+		tc := req.GetTargetCriteria()
+		if tc == nil {
+			problems = append(problems, Problem{targetConfig, field, "target_criteria is not set"})
+			continue
+		}
+		if name := tc.GetBuilderName(); name != "" && !builders[name] {
+			problems = append(problems, Problem{targetConfig, field + ".builder_name",
+				fmt.Sprintf("builder %q is not in the builder configs", name)})
+		}
+		if target := tc.GetBuildTarget(); target != "" && !hasBuilderFor(target, builders) {
+			problems = append(problems, Problem{targetConfig, field + ".build_target",
+				fmt.Sprintf("no builder in the builder configs is named for build target %q", target)})
+		}
+	}
+	return problems
+}
+
+// hasBuilderFor returns true if a builder is named <target>-<type>.
+func hasBuilderFor(target string, builders map[string]bool) bool {
+	for name := range builders {
+		if strings.HasPrefix(name, target+"-") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"go.chromium.org/chromiumos/infra/proto/go/chromiumos"
+	"go.chromium.org/chromiumos/infra/proto/go/testplans"
+)
+
+func targetCfg() *testplans.TargetTestRequirementsCfg {
+	return &testplans.TargetTestRequirementsCfg{
+		PerTargetTestRequirements: []*testplans.PerTargetTestRequirements{
+			{
+				TargetCriteria: &testplans.TargetCriteria{
+					TargetType:  &testplans.TargetCriteria_BuildTarget{BuildTarget: "eve"},
+					BuilderName: "eve-cq",
+				},
+				HwTestCfg: &testplans.HwTestCfg{HwTest: []*testplans.HwTestCfg_HwTest{
+					{Suite: "bvt-inline", Common: &testplans.TestSuiteCommon{
+						TestSuiteGroups: []*testplans.TestSuiteCommon_TestSuiteGroup{{TestSuiteGroup: "hw"}},
+					}},
+				}},
+			},
+			{
+				TargetCriteria: &testplans.TargetCriteria{
+					TargetType:  &testplans.TargetCriteria_BuildTarget{BuildTarget: "kevin"},
+					BuilderName: "kevin-postsubmit",
+				},
+			},
+		},
+	}
+}
+
+func builderConfigs() *chromiumos.BuilderConfigs {
+	return &chromiumos.BuilderConfigs{BuilderConfigs: []*chromiumos.BuilderConfig{
+		{Id: &chromiumos.BuilderConfig_Id{Name: "eve-cq"}},
+	}}
+}
+
+func TestLintClean(t *testing.T) {
+	sourceCfg := &testplans.SourceTreeTestCfg{SourceTestRules: []*testplans.SourceTestRules{
+		{
+			FilePattern: &testplans.FilePattern{Pattern: "chromite/**/*.py", ExcludePatterns: []string{"**/OWNERS"}},
+			SubtractiveRule: &testplans.SubtractiveRule{
+				OnlyKeepOneSuiteFromEachGroup: &testplans.TestGroups{Name: []string{"hw"}},
+			},
+		},
+	}}
+	cfg := targetCfg()
+	cfg.PerTargetTestRequirements = cfg.PerTargetTestRequirements[:1]
+
+	if problems := Lint(sourceCfg, cfg, builderConfigs()); len(problems) != 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+}
+
+func TestLintProblems(t *testing.T) {
+	sourceCfg := &testplans.SourceTreeTestCfg{SourceTestRules: []*testplans.SourceTestRules{
+		// Bad pattern, undefined group.
+		{
+			FilePattern: &testplans.FilePattern{Pattern: "src/[a-/*.c"},
+			AdditiveRule: &testplans.AdditiveRule{
+				AddAllSuitesInGroups: &testplans.TestGroups{Name: []string{"missing"}},
+			},
+		},
+		// No rule, empty group list.
+		{
+			FilePattern: &testplans.FilePattern{Pattern: "src/**", ExcludePatterns: []string{"\\"}},
+		},
+		{
+			FilePattern: &testplans.FilePattern{},
+			SubtractiveRule: &testplans.SubtractiveRule{
+				OnlyKeepAllSuitesInGroups: &testplans.TestGroups{},
+			},
+		},
+	}}
+
+	problems := Lint(sourceCfg, targetCfg(), builderConfigs())
+	expected := []string{
+		"source_test_rules[0].file_pattern.pattern",
+		"source_test_rules[0].additive_rule.add_all_suites_in_groups",
+		"source_test_rules[1].file_pattern.exclude_patterns[0]",
+		"source_test_rules[1]",
+		"source_test_rules[2].file_pattern.pattern",
+		"source_test_rules[2].subtractive_rule.only_keep_all_suites_in_groups",
+		"per_target_test_requirements[1].target_criteria.builder_name",
+		"per_target_test_requirements[1].target_criteria.build_target",
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("expected %v problems, got %v:\n%v", len(expected), len(problems), problems)
+	}
+	for i, p := range problems {
+		if p.Field != expected[i] {
+			t.Errorf("problem %v is %v, expected field %v", i, p, expected[i])
+		}
+	}
+	if !strings.Contains(problems[1].Message, `"missing"`) {
+		t.Errorf("problem doesn't name the missing group: %v", problems[1])
+	}
+}
+
+func TestLintNoBuilderConfigs(t *testing.T) {
+	if problems := Lint(&testplans.SourceTreeTestCfg{}, targetCfg(), nil); len(problems) != 0 {
+		t.Errorf("expected no problems without builder configs, got %v", problems)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 The Chromium OS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"go.chromium.org/chromiumos/infra/proto/go/chromiumos"
+	"go.chromium.org/chromiumos/infra/proto/go/testplans"
+
+	"go.chromium.org/chromiumos/infra/go/cmd/testconfig_lint/lint"
+)
+
+// USAGE is printed by flags on --help.
+const USAGE = `
+Testconfig lint validates a SourceTreeTestCfg and TargetTestRequirementsCfg
+before they are uploaded: file patterns must compile, suite groups used in
+source test rules must have suites, and (given builder configs) the builders
+and build targets of target criteria must exist.
+
+It exits 0 if no problems are found, 1 if any are and 2 on usage errors. It is
+intended to run in the config repo's presubmit.
+`
+
+// readProto reads msg from path in binary or json representation.
+func readProto(path string, msg proto.Message) error {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("couldn't read %v: %v", path, err)
+	}
+	if err := proto.Unmarshal(in, msg); err != nil {
+		// Try jsonpb.
+		msg.Reset()
+		if err = jsonpb.Unmarshal(bytes.NewReader(in), msg); err != nil {
+			return fmt.Errorf("%v couldn't be unmarshaled: %v", path, err)
+		}
+	}
+	return nil
+}
+
+func main() {
+	// Print usage.
+	flag.Usage = func() {
+		fmt.Printf("%v\n", USAGE)
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	// Loggings Flags.
+	flag.Set("logtostderr", "true")
+	flag.Set("stderrthreshold", "WARNING")
+	flag.Set("v", "0")
+
+	sourceTreeConfigPath := flag.String("sourceTreeConfigPath", "", "the "+
+		"SourceTreeTestCfg input path (in binary or json representation).")
+
+	targetTestRequirementsPath := flag.String("targetTestRequirementsPath", "",
+		"the TargetTestRequirementsCfg input path (in binary or json representation).")
+
+	builderConfigsPath := flag.String("builderConfigsPath", "", "optional "+
+		"BuilderConfigs input path, builders and build targets are checked if set.")
+
+	jsonOutFile := flag.String("jsonOutFile", "", "set if the problems should "+
+		"be written to a json file instead of plain text to stdout.")
+
+	flag.Parse()
+
+	if *sourceTreeConfigPath == "" || *targetTestRequirementsPath == "" {
+		fmt.Fprintf(os.Stderr, "Error: --sourceTreeConfigPath and --targetTestRequirementsPath are required\n")
+		flag.Usage()
+	}
+
+	sourceCfg := &testplans.SourceTreeTestCfg{}
+	if err := readProto(*sourceTreeConfigPath, sourceCfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	targetCfg := &testplans.TargetTestRequirementsCfg{}
+	if err := readProto(*targetTestRequirementsPath, targetCfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	var builderConfigs *chromiumos.BuilderConfigs
+	if *builderConfigsPath != "" {
+		builderConfigs = &chromiumos.BuilderConfigs{}
+		if err := readProto(*builderConfigsPath, builderConfigs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	problems := lint.Lint(sourceCfg, targetCfg, builderConfigs)
+
+	if *jsonOutFile != "" {
+		if jsonBytes, err := json.Marshal(problems); err != nil {
+			glog.Errorf("json marshalling failed: %v\n", err)
+		} else if err := ioutil.WriteFile(*jsonOutFile, jsonBytes, 0644); err != nil {
+			glog.Errorf("json output write failed: %v\n", err)
+		}
+	} else {
+		for _, p := range problems {
+			fmt.Println(p.String())
+		}
+	}
+
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+}